@@ -0,0 +1,128 @@
+package payplug
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchOptions configures the batch helpers.
+type BatchOptions struct {
+	Workers  int           // Maximum number of concurrent requests (default to 4)
+	Interval time.Duration // Minimum delay between the start of two requests (0 for no limit)
+	Retries  int           // Number of retries when PayPlug answers 429 Too Many Requests
+}
+
+const (
+	defaultBatchWorkers = 4
+	rateLimitBackoff    = 500 * time.Millisecond // doubled on each retry
+)
+
+// BatchResult is the outcome of one item of a batch.
+type BatchResult[T any] struct {
+	Id    string // The ID of the item (payment ID)
+	Value T      // valid if Err is nil
+	Err   error
+}
+
+// BatchItemError is the error of one item of a batch.
+type BatchItemError struct {
+	Index int    // Position of the item in the batch
+	Id    string // The ID of the item, which may appear several times in a batch
+	Err   error
+}
+
+// BatchError aggregates the errors of a batch.
+type BatchError struct {
+	Total  int
+	Errors []BatchItemError // sorted by index
+}
+
+func (b BatchError) Error() string {
+	msgs := make([]string, len(b.Errors))
+	for i, e := range b.Errors {
+		msgs[i] = fmt.Sprintf("#%d %s: %s", e.Index, e.Id, e.Err)
+	}
+	return fmt.Sprintf("%d of %d operation(s) failed: %s", len(b.Errors), b.Total, strings.Join(msgs, "; "))
+}
+
+// runBatch calls `op` for each of `ids`, with at most `opts.Workers`
+// concurrent calls. Results are returned in the order of `ids`.
+func runBatch[T any](ids []string, opts BatchOptions, op func(i int) (T, error)) ([]BatchResult[T], error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+	var ticker *time.Ticker
+	if opts.Interval > 0 {
+		ticker = time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+	}
+
+	out := make([]BatchResult[T], len(ids))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				v, err := op(i)
+				for try, backoff := 0, rateLimitBackoff; try < opts.Retries && isRateLimited(err); try, backoff = try+1, 2*backoff {
+					time.Sleep(backoff)
+					v, err = op(i)
+				}
+				out[i] = BatchResult[T]{Id: ids[i], Value: v, Err: err}
+			}
+		}()
+	}
+	for i := range ids {
+		if ticker != nil && i > 0 {
+			<-ticker.C
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var errs []BatchItemError
+	for i, r := range out {
+		if r.Err != nil {
+			errs = append(errs, BatchItemError{Index: i, Id: r.Id, Err: r.Err})
+		}
+	}
+	if len(errs) != 0 {
+		return out, BatchError{Total: len(ids), Errors: errs}
+	}
+	return out, nil
+}
+
+func isRateLimited(err error) bool {
+	h, ok := err.(HttpError)
+	return ok && h.code == http.StatusTooManyRequests
+}
+
+// GetPayments retrieves the payments `ids` concurrently.
+func (s Session) GetPayments(ids []string, opts BatchOptions) ([]BatchResult[Payment], error) {
+	return runBatch(ids, opts, func(i int) (Payment, error) { return s.GetPayment(ids[i]) })
+}
+
+// AbortPayments aborts the payments `ids` concurrently.
+func (s Session) AbortPayments(ids []string, opts BatchOptions) ([]BatchResult[Payment], error) {
+	return runBatch(ids, opts, func(i int) (Payment, error) { return s.AbortPayment(ids[i]) })
+}
+
+// RefundPayments creates the refunds of `plan` concurrently,
+// attaching `metadata` to each of them.
+// Result IDs are the payment IDs.
+func (s Session) RefundPayments(plan RefundPlan, metadata Metadata, opts BatchOptions) ([]BatchResult[Refund], error) {
+	ids := make([]string, len(plan))
+	for i, r := range plan {
+		ids[i] = r.PaymentId
+	}
+	return runBatch(ids, opts, func(i int) (Refund, error) {
+		return s.CreateRefund(plan[i].PaymentId, Refund{Amount: plan[i].Amount.Value, Metadata: metadata})
+	})
+}
@@ -0,0 +1,64 @@
+package payplug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatch(t *testing.T) {
+	var running, maxRunning, limited int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(2 * time.Millisecond)
+
+		id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		switch {
+		case id == "pay_missing":
+			http.Error(w, "{}", http.StatusNotFound)
+		case id == "pay_limited" && atomic.AddInt32(&limited, 1) == 1:
+			http.Error(w, "{}", http.StatusTooManyRequests)
+		default:
+			json.NewEncoder(w).Encode(Payment{Id: id})
+		}
+	}))
+	defer api.Close()
+
+	s := NewSession("sk_test")
+	s.SetBaseUrl(api.URL)
+	var ids []string
+	for i := 0; i < 50; i++ {
+		ids = append(ids, "pay_"+strings.Repeat("x", i))
+	}
+	ids = append(ids, "pay_missing", "pay_limited", "pay_missing") // duplicates are reported once each
+
+	results, err := s.GetPayments(ids, BatchOptions{Workers: 5, Retries: 1})
+	batchErr, ok := err.(BatchError)
+	if !ok || len(batchErr.Errors) != 2 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for i, e := range batchErr.Errors {
+		if exp := []int{50, 52}[i]; e.Index != exp || e.Id != "pay_missing" || e.Err == nil {
+			t.Fatalf("unexpected item error %v", e)
+		}
+	}
+	for i, r := range results {
+		if r.Id != ids[i] || (r.Err == nil && r.Value.Id != ids[i]) {
+			t.Fatalf("unexpected result %d: %v", i, r)
+		}
+	}
+	if maxRunning > 5 {
+		t.Fatalf("expected at most 5 concurrent requests, got %d", maxRunning)
+	}
+}
@@ -0,0 +1,125 @@
+package payplug
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	_ "embed"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+)
+
+// bundledCA is the Mozilla CA bundle, used by NewSessionWithBundledCA
+//
+//go:embed certs/cacert.pem
+var bundledCA []byte
+
+// CABundle is a set of root certificates which may be replaced
+// at runtime, without rebuilding the sessions using it.
+// It is safe for concurrent use.
+type CABundle struct {
+	pool atomic.Pointer[x509.CertPool]
+}
+
+// BundledCA returns a new CABundle initialized with the
+// CA bundle embedded in the package.
+func BundledCA() *CABundle {
+	var b CABundle
+	if err := b.Load(bundledCA); err != nil {
+		panic("invalid embedded CA bundle: " + err.Error())
+	}
+	return &b
+}
+
+// CheckCABundle parses the PEM encoded `bundle` and returns
+// the number of certificates. An error is returned if a block
+// is not a valid certificate, or if there is no certificate.
+func CheckCABundle(bundle []byte) (int, error) {
+	_, n, err := parseCABundle(bundle)
+	return n, err
+}
+
+func parseCABundle(bundle []byte) (*x509.CertPool, int, error) {
+	pool := x509.NewCertPool()
+	n := 0
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid certificate %d: %s", n+1, err)
+		}
+		pool.AddCert(cert)
+		n++
+	}
+	if n == 0 {
+		return nil, 0, errors.New("no certificate found in CA bundle")
+	}
+	return pool, n, nil
+}
+
+// Load replaces the certificates by the PEM encoded `bundle`.
+// The current certificates are kept if `bundle` is invalid.
+func (b *CABundle) Load(bundle []byte) error {
+	pool, _, err := parseCABundle(bundle)
+	if err != nil {
+		return err
+	}
+	b.pool.Store(pool)
+	return nil
+}
+
+// LoadFile is the same as Load, reading the bundle from `path`.
+func (b *CABundle) LoadFile(path string) error {
+	bundle, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading CA bundle: %s", err)
+	}
+	return b.Load(bundle)
+}
+
+// verify checks the chain of the server against the current certificates,
+// returning the verified chains
+func (b *CABundle) verify(cs tls.ConnectionState) ([][]*x509.Certificate, error) {
+	if cs.ServerName == "" {
+		return nil, errors.New("missing server name to verify the certificate")
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return nil, errors.New("missing server certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         b.pool.Load(),
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   time.Now(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	return cs.PeerCertificates[0].Verify(opts)
+}
+
+// WithCABundle verifies the server certificates against `bundle`
+// instead of the system store. Calls to `bundle.Load` apply to the
+// following connections.
+// The transport must be an *http.Transport without custom TLS dialer:
+// otherwise, the requests of the session fail.
+func WithCABundle(bundle *CABundle) Option {
+	return func(c *config) { c.caBundle = bundle }
+}
+
+// NewSessionWithBundledCA is the same as NewSession, but verifies the
+// server certificates with the CA bundle embedded in the package,
+// for systems without CA store.
+func NewSessionWithBundledCA(secretKey string, opts ...Option) Session {
+	return NewSession(secretKey, append([]Option{WithCABundle(BundledCA())}, opts...)...)
+}
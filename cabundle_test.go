@@ -0,0 +1,65 @@
+package payplug
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundledCA(t *testing.T) {
+	n, err := CheckCABundle(bundledCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 100 {
+		t.Fatalf("unexpected small bundle: %d certificates", n)
+	}
+	if _, err = CheckCABundle([]byte("not a bundle")); err == nil {
+		t.Fatal("expected error for invalid bundle")
+	}
+}
+
+func TestCABundleReload(t *testing.T) {
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Payment{Id: "pay_1"})
+	}))
+	defer api.Close()
+
+	bundle := BundledCA()
+	// the test transport trusts the test certificate: only the bundle must be used
+	s := NewSession("sk_test", WithBaseUrl("https://example.com"), WithTransport(exampleTransport(api)), WithCABundle(bundle))
+	if _, err := s.GetPayment("pay_1"); err == nil {
+		t.Fatal("expected unknown authority error")
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := bundle.LoadFile(path); err == nil {
+		t.Fatal("expected error for invalid bundle")
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: api.Certificate().Raw})
+	if err := os.WriteFile(path, cert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := bundle.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	api.CloseClientConnections()
+	if _, err := s.GetPayment("pay_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bundle can't be enforced by a custom transport: refuse it
+	s = NewSession("sk_test", WithBaseUrl("https://example.com"), WithTransport(wrappedTransport{exampleTransport(api)}), WithCABundle(bundle))
+	if _, err := s.GetPayment("pay_1"); err == nil || !strings.Contains(err.Error(), "CA bundle requires") {
+		t.Fatalf("expected transport error, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package payplug
+
+import "io"
+
+// Client gathers the operations of a Session, so that code depending
+// on it may be tested without HTTP (see the payplugtest package).
+type Client interface {
+	Request(method, url string, body interface{}, out interface{}) (status int, err error)
+
+	CreatePayment(payment Payment) (Payment, error)
+	CreatePaymentIdempotent(key string, payment Payment) (Payment, error)
+	GetPayment(id string) (Payment, error)
+	ListPayments(page, perPage int) (PaymentList, error)
+	WalkPayments(from, to Timestamp, fn func(Payment) error) error
+	AbortPayment(id string) (Payment, error)
+
+	CreateRefund(paymentId string, refund Refund) (Refund, error)
+	CreateRefundIdempotent(key string, paymentId string, refund Refund) (Refund, error)
+	ListRefunds(paymentId string) (RefundList, error)
+	ExecuteRefundPlan(plan RefundPlan, metadata Metadata) ([]RefundOutcome, error)
+
+	GetPayments(ids []string, opts BatchOptions) ([]BatchResult[Payment], error)
+	AbortPayments(ids []string, opts BatchOptions) ([]BatchResult[Payment], error)
+	RefundPayments(plan RefundPlan, metadata Metadata, opts BatchOptions) ([]BatchResult[Refund], error)
+
+	CreateCustomer(customer Customer) (Customer, error)
+	GetCustomer(id string) (Customer, error)
+	ListCustomers(page, perPage int) (CustomerList, error)
+	DeleteCustomer(id string) error
+	ListCards(customerId string) (CardList, error)
+	GetCard(customerId, cardId string) (Card, error)
+	DeleteCard(customerId, cardId string) error
+
+	GetInstallmentPlan(id string) (InstallmentPlan, error)
+
+	CreateAccountingReport(report AccountingReport) (AccountingReport, error)
+	GetAccountingReport(id string) (AccountingReport, error)
+
+	HandleNotificationPayment(body io.Reader) (Payment, error)
+	HandleNotificationRefund(body io.Reader) (Refund, error)
+	HandleNotificationAccountingReport(body io.Reader) (AccountingReport, error)
+	HandleNotificationInstallmentPlan(body io.Reader) (InstallmentPlan, error)
+}
+
+var _ Client = Session{}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+// parseArgs parses the flags of an action, and checks that
+// exactly `positional` arguments remain.
+func parseArgs(fs *flag.FlagSet, args []string, positional ...string) ([]string, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s [flags] %s\n", fs.Name(), strings.Join(positional, " "))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != len(positional) {
+		fs.Usage()
+		return nil, fmt.Errorf("%s: expected %d argument(s), got %d", fs.Name(), len(positional), fs.NArg())
+	}
+	return fs.Args(), nil
+}
+
+// metadataFlag accumulates key=value pairs
+type metadataFlag payplug.Metadata
+
+func (m metadataFlag) String() string { return fmt.Sprint(map[string]interface{}(m)) }
+
+func (m metadataFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("invalid metadata %q, expected key=value", s)
+	}
+	m[k] = v
+	return nil
+}
+
+var paymentCommand = command{
+	usage: `  payment create -amount <minor units> -email <email> [flags]
+  payment get <payment id>
+  payment list [-page n] [-per-page n]
+  payment abort <payment id>
+  payment refund [-amount <minor units>] <payment id>
+  payment refunds <payment id>`,
+	actions: map[string]action{
+		"create":  createPayment,
+		"get":     getPayment,
+		"list":    listPayments,
+		"abort":   abortPayment,
+		"refund":  refundPayment,
+		"refunds": listRefunds,
+	},
+}
+
+func createPayment(s payplug.Session, out printer, args []string) error {
+	fs := flag.NewFlagSet("payment create", flag.ContinueOnError)
+	var (
+		p        payplug.Payment
+		metadata = metadataFlag{}
+	)
+	fs.UintVar(&p.Amount, "amount", 0, "amount of the payment, in minor units (cents for EUR)")
+	currency := fs.String("currency", string(payplug.Eur), "currency (ISO 4217)")
+	fs.StringVar(&p.Billing.Email, "email", "", "customer email")
+	fs.StringVar(&p.Billing.FirstName, "first-name", "", "customer first name")
+	fs.StringVar(&p.Billing.LastName, "last-name", "", "customer last name")
+	fs.StringVar(&p.Billing.Address1, "address", "", "customer address")
+	fs.StringVar(&p.Billing.Postcode, "postcode", "", "customer postcode")
+	fs.StringVar(&p.Billing.City, "city", "", "customer city")
+	fs.StringVar(&p.Billing.Country, "country", "FR", "customer country (ISO 3166)")
+	fs.StringVar(&p.Billing.Language, "language", "fr", "customer language (ISO 639-1)")
+	fs.StringVar(&p.HostedPayment.ReturnUrl, "return-url", "", "URL the customer is redirected to after the payment")
+	fs.StringVar(&p.HostedPayment.CancelUrl, "cancel-url", "", "URL the customer is redirected to on cancel")
+	fs.StringVar(&p.NotificationUrl, "notification-url", "", "URL PayPlug will send notifications to")
+	fs.StringVar(&p.Description, "description", "", "description shown to the customer")
+	method := fs.String("method", "", "payment method (bancontact, ideal, american_express, ...), card if empty")
+	fs.Var(metadata, "metadata", "custom key=value metadata (repeatable)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if p.Amount == 0 || p.Billing.Email == "" {
+		return fmt.Errorf("%s: -amount and -email are required", fs.Name())
+	}
+	p.Currency = payplug.Currency(*currency)
+	p.PaymentMethod.Type = payplug.MethodType(*method)
+	p.Shipping = payplug.Shipping{
+		FirstName: p.Billing.FirstName, LastName: p.Billing.LastName, Email: p.Billing.Email,
+		Address1: p.Billing.Address1, Postcode: p.Billing.Postcode, City: p.Billing.City,
+		Country: p.Billing.Country, Language: p.Billing.Language,
+		DeliveryType: payplug.Billing_,
+	}
+	if len(metadata) != 0 {
+		p.Metadata = payplug.Metadata(metadata)
+	}
+
+	created, err := s.CreatePayment(p)
+	if err != nil {
+		return err
+	}
+	return out.print(created, []string{"ID", "PAYMENT URL"}, []string{created.Id, created.HostedPayment.PaymentUrl})
+}
+
+func getPayment(s payplug.Session, out printer, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("payment get", flag.ContinueOnError), args, "<payment id>")
+	if err != nil {
+		return err
+	}
+	p, err := s.GetPayment(args[0])
+	if err != nil {
+		return err
+	}
+	return out.print(p, paymentHeader, paymentRow(p))
+}
+
+func listPayments(s payplug.Session, out printer, args []string) error {
+	fs := flag.NewFlagSet("payment list", flag.ContinueOnError)
+	page := fs.Int("page", 0, "page index, starting at 0")
+	perPage := fs.Int("per-page", 10, "number of payments per page (at most 50)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	list, err := s.ListPayments(*page, *perPage)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(list.Data))
+	for i, p := range list.Data {
+		rows[i] = paymentRow(p)
+	}
+	return out.print(list, paymentHeader, rows...)
+}
+
+func abortPayment(s payplug.Session, out printer, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("payment abort", flag.ContinueOnError), args, "<payment id>")
+	if err != nil {
+		return err
+	}
+	p, err := s.AbortPayment(args[0])
+	if err != nil {
+		return err
+	}
+	return out.print(p, paymentHeader, paymentRow(p))
+}
+
+func refundPayment(s payplug.Session, out printer, args []string) error {
+	fs := flag.NewFlagSet("payment refund", flag.ContinueOnError)
+	amount := fs.Uint("amount", 0, "amount to refund, in minor units (default: the remaining amount)")
+	args, err := parseArgs(fs, args, "<payment id>")
+	if err != nil {
+		return err
+	}
+	r, err := s.CreateRefund(args[0], payplug.Refund{Amount: *amount})
+	if err != nil {
+		return err
+	}
+	return out.print(r, refundHeader, refundRow(r))
+}
+
+func listRefunds(s payplug.Session, out printer, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("payment refunds", flag.ContinueOnError), args, "<payment id>")
+	if err != nil {
+		return err
+	}
+	list, err := s.ListRefunds(args[0])
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(list.Data))
+	for i, r := range list.Data {
+		rows[i] = refundRow(r)
+	}
+	return out.print(list, refundHeader, rows...)
+}
+
+var customerCommand = command{
+	usage: `  customer create -email <email> [-first-name name] [-last-name name]
+  customer get <customer id>
+  customer list [-page n] [-per-page n]
+  customer delete <customer id>`,
+	actions: map[string]action{
+		"create": createCustomer,
+		"get":    getCustomer,
+		"list":   listCustomers,
+		"delete": deleteCustomer,
+	},
+}
+
+func createCustomer(s payplug.Session, out printer, args []string) error {
+	fs := flag.NewFlagSet("customer create", flag.ContinueOnError)
+	var c payplug.Customer
+	fs.StringVar(&c.Email, "email", "", "customer email")
+	fs.StringVar(&c.FirstName, "first-name", "", "customer first name")
+	fs.StringVar(&c.LastName, "last-name", "", "customer last name")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if c.Email == "" {
+		return fmt.Errorf("%s: -email is required", fs.Name())
+	}
+	c, err := s.CreateCustomer(c)
+	if err != nil {
+		return err
+	}
+	return out.print(c, customerHeader, customerRow(c))
+}
+
+func getCustomer(s payplug.Session, out printer, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("customer get", flag.ContinueOnError), args, "<customer id>")
+	if err != nil {
+		return err
+	}
+	c, err := s.GetCustomer(args[0])
+	if err != nil {
+		return err
+	}
+	return out.print(c, customerHeader, customerRow(c))
+}
+
+func listCustomers(s payplug.Session, out printer, args []string) error {
+	fs := flag.NewFlagSet("customer list", flag.ContinueOnError)
+	page := fs.Int("page", 0, "page index, starting at 0")
+	perPage := fs.Int("per-page", 10, "number of customers per page (at most 50)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	list, err := s.ListCustomers(*page, *perPage)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(list.Data))
+	for i, c := range list.Data {
+		rows[i] = customerRow(c)
+	}
+	return out.print(list, customerHeader, rows...)
+}
+
+func deleteCustomer(s payplug.Session, out printer, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("customer delete", flag.ContinueOnError), args, "<customer id>")
+	if err != nil {
+		return err
+	}
+	return s.DeleteCustomer(args[0])
+}
+
+var cardCommand = command{
+	usage: `  card list <customer id>
+  card get <customer id> <card id>
+  card delete <customer id> <card id>`,
+	actions: map[string]action{
+		"list":   listCards,
+		"get":    getCard,
+		"delete": deleteCard,
+	},
+}
+
+func listCards(s payplug.Session, out printer, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("card list", flag.ContinueOnError), args, "<customer id>")
+	if err != nil {
+		return err
+	}
+	list, err := s.ListCards(args[0])
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(list.Data))
+	for i, c := range list.Data {
+		rows[i] = cardRow(c)
+	}
+	return out.print(list, cardHeader, rows...)
+}
+
+func getCard(s payplug.Session, out printer, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("card get", flag.ContinueOnError), args, "<customer id>", "<card id>")
+	if err != nil {
+		return err
+	}
+	c, err := s.GetCard(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	return out.print(c, cardHeader, cardRow(c))
+}
+
+func deleteCard(s payplug.Session, out printer, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("card delete", flag.ContinueOnError), args, "<customer id>", "<card id>")
+	if err != nil {
+		return err
+	}
+	return s.DeleteCard(args[0], args[1])
+}
+
+var reportCommand = command{
+	usage: `  report create -start <YYYY-MM-DD> -end <YYYY-MM-DD> [-notification-url url]
+  report get <report id>`,
+	actions: map[string]action{
+		"create": createReport,
+		"get":    getReport,
+	},
+}
+
+func createReport(s payplug.Session, out printer, args []string) error {
+	fs := flag.NewFlagSet("report create", flag.ContinueOnError)
+	var a payplug.AccountingReport
+	fs.StringVar(&a.StartDate, "start", "", "start date (YYYY-MM-DD)")
+	fs.StringVar(&a.EndDate, "end", "", "end date (YYYY-MM-DD)")
+	fs.StringVar(&a.NotificationUrl, "notification-url", "", "URL PayPlug will send a notification to")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if a.StartDate == "" || a.EndDate == "" {
+		return fmt.Errorf("%s: -start and -end are required", fs.Name())
+	}
+	a, err := s.CreateAccountingReport(a)
+	if err != nil {
+		return err
+	}
+	return out.print(a, reportHeader, reportRow(a))
+}
+
+func getReport(s payplug.Session, out printer, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("report get", flag.ContinueOnError), args, "<report id>")
+	if err != nil {
+		return err
+	}
+	a, err := s.GetAccountingReport(args[0])
+	if err != nil {
+		return err
+	}
+	return out.print(a, reportHeader, reportRow(a))
+}
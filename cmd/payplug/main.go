@@ -0,0 +1,122 @@
+// Command payplug is a command-line tool for day-to-day PayPlug operations.
+//
+// The secret key is read from the PAYPLUG_SECRET_KEY environment variable.
+// It is not required by the notify command, which only simulates
+// notifications locally.
+// To avoid mistakes, -live requires a live key (sk_live_...), and
+// a test key (sk_test_...) is required otherwise: any other key is rejected.
+//
+// Usage:
+//
+//	payplug [-live] [-json] <command> <action> [arguments]
+//
+// Run `payplug help` for the list of commands.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+const keyEnv = "PAYPLUG_SECRET_KEY"
+
+// command is a top-level command, with either its actions,
+// or a single `run` function
+type command struct {
+	usage   string
+	actions map[string]action
+	run     action
+	offline bool // if true, no secret key is required
+}
+
+// action runs a sub-command with the remaining arguments
+type action func(s payplug.Session, out printer, args []string) error
+
+var commands = map[string]command{
+	"payment":  paymentCommand,
+	"customer": customerCommand,
+	"card":     cardCommand,
+	"report":   reportCommand,
+	"notify":   notifyCommand,
+}
+
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintf(os.Stderr, "usage: payplug [-live] [-json] <command> <action> [arguments]\n\nglobal flags:\n")
+	fs.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\ncommands:\n")
+	for _, name := range sortedKeys(commands) {
+		fmt.Fprintf(os.Stderr, "%s\n", commands[name].usage)
+	}
+}
+
+// checkMode enforces the -test/-live guard: the key must
+// start with sk_live_ in live mode, and sk_test_ otherwise.
+func checkMode(key string, live bool) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("%s is not set", keyEnv)
+	case live && !strings.HasPrefix(key, "sk_live_"):
+		return errors.New("-live requires a live key (sk_live_...)")
+	case !live && !strings.HasPrefix(key, "sk_test_"):
+		return errors.New("test mode requires a test key (sk_test_...), use -live for a live key")
+	}
+	return nil
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("payplug", flag.ContinueOnError)
+	fs.Usage = func() { usage(fs) }
+	live := fs.Bool("live", false, "operate in LIVE mode (requires a live key)")
+	test := fs.Bool("test", false, "operate in TEST mode (the default, requires a test key)")
+	asJSON := fs.Bool("json", false, "print raw JSON instead of tables")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *live && *test {
+		return errors.New("-live and -test are mutually exclusive")
+	}
+
+	args = fs.Args()
+	if len(args) == 0 || args[0] == "help" {
+		usage(fs)
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	act, args := cmd.run, args[1:]
+	if act == nil {
+		if len(args) == 0 {
+			return fmt.Errorf("missing action; usage:\n%s", cmd.usage)
+		}
+		act, ok = cmd.actions[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown action %q; usage:\n%s", args[0], cmd.usage)
+		}
+		args = args[1:]
+	}
+
+	key := os.Getenv(keyEnv)
+	if !cmd.offline {
+		if err := checkMode(key, *live); err != nil {
+			return err
+		}
+	}
+	return act(payplug.NewSession(key), newPrinter(os.Stdout, *asJSON), args)
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "payplug:", err)
+		os.Exit(1)
+	}
+}
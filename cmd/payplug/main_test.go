@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+func TestCheckMode(t *testing.T) {
+	for _, test := range []struct {
+		key   string
+		live  bool
+		valid bool
+	}{
+		{"", false, false},
+		{"sk_test_xxx", false, true},
+		{"sk_test_xxx", true, false},
+		{"sk_live_xxx", false, false},
+		{"sk_live_xxx", true, true},
+		{"sk_tset_xxx", false, false}, // mistyped prefix
+		{"sk_tset_xxx", true, false},
+		{"eyJhbGciOi", false, false}, // OAuth token
+		{"eyJhbGciOi", true, false},
+	} {
+		if err := checkMode(test.key, test.live); (err == nil) != test.valid {
+			t.Errorf("key %q, live %v: unexpected error %v", test.key, test.live, err)
+		}
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	var buf bytes.Buffer
+	p := payplug.Payment{Id: "pay_1", Amount: 1250, Currency: payplug.Eur, CreatedAt: 1434010787}
+	if err := newPrinter(&buf, false).print(p, paymentHeader, paymentRow(p)); err != nil {
+		t.Fatal(err)
+	}
+	exp := "ID     CREATED           AMOUNT     REFUNDED  PAID   EMAIL  FAILURE\n" +
+		"pay_1  2015-06-11 08:19  12.50 EUR  0.00 EUR  false         -\n"
+	if buf.String() != exp {
+		t.Fatalf("expected\n%q\ngot\n%q", exp, buf.String())
+	}
+}
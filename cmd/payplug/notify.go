@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+var notifyCommand = command{
+	usage: `  notify -url <webhook url> [-type payment|refund|accounting_report] [-serve addr] [flags]
+      POST a simulated notification to a local endpoint; with -serve, also answer
+      the re-fetch request (point the endpoint's Session to it with SetBaseUrl)`,
+	run:     notify,
+	offline: true,
+}
+
+// notification is a simulated PayPlug object
+type notification struct {
+	object interface{} // the resource, sent as body and served on re-fetch
+	path   string      // the path of the resource, relative to API_BASE_URL
+}
+
+// newNotification builds the body of a notification of type `kind`.
+// If `fixture` is not nil, its JSON fields override the generated ones.
+func newNotification(kind string, fixture io.Reader, id, paymentId string, amount uint, failure string, metadata payplug.Metadata) (notification, error) {
+	now := payplug.Timestamp(time.Now().Unix())
+	var object interface{}
+	switch kind {
+	case "payment":
+		p := payplug.Payment{Id: id, Object: "payment", Amount: amount, Currency: payplug.Eur, CreatedAt: now, Metadata: metadata}
+		if failure != "" {
+			p.Failure = payplug.OptionnalFailure{Valid: true, Failure: payplug.Failure{Code: payplug.PaymentFailureCode(failure)}}
+		} else {
+			p.IsPaid, p.PaidAt = true, now
+		}
+		object = &p
+	case "refund":
+		object = &payplug.Refund{Id: id, PaymentId: paymentId, Object: "refund", Amount: amount, Currency: payplug.Eur, CreatedAt: now, Metadata: metadata}
+	case "accounting_report":
+		object = &payplug.AccountingReport{Id: id, Object: "accounting_report", TemporaryUrl: "http://localhost/report.csv", FileAvailableUntil: now + 24*3600}
+	default:
+		return notification{}, fmt.Errorf("unknown notification type %q", kind)
+	}
+
+	if fixture != nil {
+		if err := json.NewDecoder(fixture).Decode(object); err != nil {
+			return notification{}, fmt.Errorf("invalid fixture: %s", err)
+		}
+	}
+
+	var url string
+	switch o := object.(type) {
+	case *payplug.Payment:
+		url = payplug.PAYMENT_RESOURCE + "/" + o.Id
+	case *payplug.Refund:
+		url = fmt.Sprintf(payplug.REFUND_RESOURCE, o.PaymentId) + "/" + o.Id
+	case *payplug.AccountingReport:
+		url = payplug.ACCOUNTING_REPORT_RESOURCE + "/" + o.Id
+	}
+	return notification{object: object, path: strings.TrimPrefix(url, payplug.API_BASE_URL)}, nil
+}
+
+// ServeHTTP answers the re-fetch request of the notification.
+func (n notification) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || r.URL.Path != n.path {
+		http.Error(w, `{"message": "not found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n.object)
+}
+
+// send POSTs the notification to `url`, returning the response status.
+func (n notification) send(url string) (int, error) {
+	b, err := json.Marshal(n.object)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func notify(_ payplug.Session, out printer, args []string) error {
+	fs := flag.NewFlagSet("notify", flag.ContinueOnError)
+	target := fs.String("url", "", "URL of the local notification endpoint")
+	kind := fs.String("type", "payment", "type of the notified object: payment, refund or accounting_report")
+	serve := fs.String("serve", "", "address on which to serve the re-fetch request (for instance localhost:8081)")
+	linger := fs.Duration("linger", 0, "how long to keep serving after the notification is sent")
+	fixture := fs.String("fixture", "", "JSON file overriding the generated object")
+	id := fs.String("id", "pay_local", "ID of the object")
+	paymentId := fs.String("payment-id", "pay_local", "ID of the refunded payment (for refunds)")
+	amount := fs.Uint("amount", 1000, "amount, in minor units")
+	failure := fs.String("failure", "", "failure code, for an unsuccessful payment")
+	metadata := metadataFlag{}
+	fs.Var(metadata, "metadata", "custom key=value metadata (repeatable)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if *target == "" {
+		return errors.New("notify: -url is required")
+	}
+
+	var fixtureReader io.Reader
+	if *fixture != "" {
+		f, err := os.Open(*fixture)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fixtureReader = f
+	}
+	var md payplug.Metadata
+	if len(metadata) != 0 {
+		md = payplug.Metadata(metadata)
+	}
+	n, err := newNotification(*kind, fixtureReader, *id, *paymentId, *amount, *failure, md)
+	if err != nil {
+		return err
+	}
+
+	if *serve != "" {
+		ln, err := net.Listen("tcp", *serve)
+		if err != nil {
+			return err
+		}
+		server := &http.Server{Handler: n}
+		go server.Serve(ln)
+		defer server.Shutdown(context.Background())
+		fmt.Fprintf(os.Stderr, "serving %s on http://%s\n", n.path, ln.Addr())
+	}
+
+	status, err := n.send(*target)
+	if err != nil {
+		return err
+	}
+	time.Sleep(*linger)
+	return out.print(map[string]int{"status": status}, []string{"TYPE", "ENDPOINT", "STATUS"},
+		[]string{*kind, *target, fmt.Sprintf("%d %s", status, strings.ToLower(http.StatusText(status)))})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+func TestNotify(t *testing.T) {
+	n, err := newNotification("payment", strings.NewReader(`{"amount": 4500}`), "pay_test", "", 1000, "", payplug.Metadata{"order": "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := httptest.NewServer(n)
+	defer api.Close()
+
+	session := payplug.NewSession("sk_test_local")
+	session.SetBaseUrl(api.URL)
+	var got payplug.Payment
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, err = session.HandleNotificationPayment(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+	defer webhook.Close()
+
+	status, err := n.send(webhook.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if got.Id != "pay_test" || got.Amount != 4500 || !got.IsPaid || got.Metadata["order"] != "42" {
+		t.Fatalf("unexpected payment %+v", got)
+	}
+}
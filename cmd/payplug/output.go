@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+// printer writes API objects either as indented JSON,
+// or as aligned tables
+type printer struct {
+	w      io.Writer
+	asJSON bool
+}
+
+func newPrinter(w io.Writer, asJSON bool) printer { return printer{w: w, asJSON: asJSON} }
+
+// print writes `v` as JSON, or the table made of `header` and `rows`.
+func (p printer) print(v interface{}, header []string, rows ...[]string) error {
+	if p.asJSON {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func sortedKeys(m map[string]command) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func formatTime(t payplug.Timestamp) string {
+	if t == 0 {
+		return "-"
+	}
+	return time.Unix(int64(t), 0).UTC().Format("2006-01-02 15:04")
+}
+
+func formatAmount(value uint, currency payplug.Currency) string {
+	return payplug.Money{Value: value, Currency: currency}.String()
+}
+
+var paymentHeader = []string{"ID", "CREATED", "AMOUNT", "REFUNDED", "PAID", "EMAIL", "FAILURE"}
+
+func paymentRow(p payplug.Payment) []string {
+	failure := "-"
+	if p.Failure.Valid {
+		failure = string(p.Failure.Failure.Code)
+	}
+	return []string{p.Id, formatTime(p.CreatedAt), formatAmount(p.Amount, p.Currency),
+		formatAmount(p.AmountRefunded, p.Currency), fmt.Sprint(p.IsPaid), p.Billing.Email, failure}
+}
+
+var refundHeader = []string{"ID", "PAYMENT", "CREATED", "AMOUNT"}
+
+func refundRow(r payplug.Refund) []string {
+	return []string{r.Id, r.PaymentId, formatTime(r.CreatedAt), formatAmount(r.Amount, r.Currency)}
+}
+
+var customerHeader = []string{"ID", "CREATED", "EMAIL", "FIRST NAME", "LAST NAME"}
+
+func customerRow(c payplug.Customer) []string {
+	return []string{c.Id, formatTime(c.CreatedAt), c.Email, c.FirstName, c.LastName}
+}
+
+var cardHeader = []string{"ID", "BRAND", "LAST 4", "EXPIRES", "COUNTRY"}
+
+func cardRow(c payplug.Card) []string {
+	return []string{c.Id, string(c.Brand), c.Last4, fmt.Sprintf("%02d/%d", c.ExpMonth, c.ExpYear), c.Country}
+}
+
+var reportHeader = []string{"ID", "START", "END", "AVAILABLE UNTIL", "URL"}
+
+func reportRow(a payplug.AccountingReport) []string {
+	return []string{a.Id, a.StartDate, a.EndDate, formatTime(a.FileAvailableUntil), a.TemporaryUrl}
+}
@@ -0,0 +1,137 @@
+package payplug
+
+import (
+	"fmt"
+)
+
+// currencyExponents maps the active ISO 4217 codes to
+// their number of minor unit digits.
+var currencyExponents = map[Currency]int{
+	"AED": 2, "AFN": 2, "ALL": 2, "AMD": 2, "ANG": 2, "AOA": 2, "ARS": 2, "AUD": 2,
+	"AWG": 2, "AZN": 2, "BAM": 2, "BBD": 2, "BDT": 2, "BGN": 2, "BHD": 3, "BIF": 0,
+	"BMD": 2, "BND": 2, "BOB": 2, "BOV": 2, "BRL": 2, "BSD": 2, "BTN": 2, "BWP": 2,
+	"BYN": 2, "BZD": 2, "CAD": 2, "CDF": 2, "CHE": 2, "CHF": 2, "CHW": 2, "CLF": 4,
+	"CLP": 0, "CNY": 2, "COP": 2, "COU": 2, "CRC": 2, "CUP": 2, "CVE": 2, "CZK": 2,
+	"DJF": 0, "DKK": 2, "DOP": 2, "DZD": 2, "EGP": 2, "ERN": 2, "ETB": 2, "EUR": 2,
+	"FJD": 2, "FKP": 2, "GBP": 2, "GEL": 2, "GHS": 2, "GIP": 2, "GMD": 2, "GNF": 0,
+	"GTQ": 2, "GYD": 2, "HKD": 2, "HNL": 2, "HTG": 2, "HUF": 2, "IDR": 2, "ILS": 2,
+	"INR": 2, "IQD": 3, "IRR": 2, "ISK": 0, "JMD": 2, "JOD": 3, "JPY": 0, "KES": 2,
+	"KGS": 2, "KHR": 2, "KMF": 0, "KPW": 2, "KRW": 0, "KWD": 3, "KYD": 2, "KZT": 2,
+	"LAK": 2, "LBP": 2, "LKR": 2, "LRD": 2, "LSL": 2, "LYD": 3, "MAD": 2, "MDL": 2,
+	"MGA": 2, "MKD": 2, "MMK": 2, "MNT": 2, "MOP": 2, "MRU": 2, "MUR": 2, "MVR": 2,
+	"MWK": 2, "MXN": 2, "MXV": 2, "MYR": 2, "MZN": 2, "NAD": 2, "NGN": 2, "NIO": 2,
+	"NOK": 2, "NPR": 2, "NZD": 2, "OMR": 3, "PAB": 2, "PEN": 2, "PGK": 2, "PHP": 2,
+	"PKR": 2, "PLN": 2, "PYG": 0, "QAR": 2, "RON": 2, "RSD": 2, "RUB": 2, "RWF": 0,
+	"SAR": 2, "SBD": 2, "SCR": 2, "SDG": 2, "SEK": 2, "SGD": 2, "SHP": 2, "SLE": 2,
+	"SOS": 2, "SRD": 2, "SSP": 2, "STN": 2, "SVC": 2, "SYP": 2, "SZL": 2, "THB": 2,
+	"TJS": 2, "TMT": 2, "TND": 3, "TOP": 2, "TRY": 2, "TTD": 2, "TWD": 2, "TZS": 2,
+	"UAH": 2, "UGX": 0, "USD": 2, "USN": 2, "UYI": 0, "UYU": 2, "UYW": 4, "UZS": 2,
+	"VED": 2, "VES": 2, "VND": 0, "VUV": 0, "WST": 2, "XAF": 0, "XCD": 2, "XCG": 2,
+	"XOF": 0, "XPF": 0, "YER": 2, "ZAR": 2, "ZMW": 2, "ZWG": 2,
+}
+
+// Valid returns true if `c` is an active ISO 4217 code.
+func (c Currency) Valid() bool {
+	_, ok := currencyExponents[c]
+	return ok
+}
+
+// Exponent returns the number of digits of the minor unit of `c`
+// (2 for EUR, 0 for JPY), or -1 if `c` is not valid.
+func (c Currency) Exponent() int {
+	e, ok := currencyExponents[c]
+	if !ok {
+		return -1
+	}
+	return e
+}
+
+// Limits are the minimum and maximum amounts (inclusive, in minor units)
+// accepted for a payment.
+type Limits struct {
+	Min, Max uint
+}
+
+// AmountLimits stores the payment amount limits by currency.
+// Currencies without entry are not checked.
+// It may be adjusted to match the limits of your PayPlug account.
+var AmountLimits = map[Currency]Limits{
+	Eur: {Min: 99, Max: 2000000},
+}
+
+// ValidateAmount checks that `c` is valid, and that `amount` is
+// within its limits.
+func (c Currency) ValidateAmount(amount uint) error {
+	if !c.Valid() {
+		return ValidationError{Field: "currency", Reason: fmt.Sprintf("%q is not an ISO 4217 code", string(c))}
+	}
+	if l, ok := AmountLimits[c]; ok && (amount < l.Min || amount > l.Max) {
+		return ValidationError{Field: "amount", Reason: fmt.Sprintf("%s is not between %s and %s",
+			Money{amount, c}, Money{l.Min, c}, Money{l.Max, c})}
+	}
+	return nil
+}
+
+// Money is an amount in a given currency.
+type Money struct {
+	Value    uint // in minor units (cents for EUR)
+	Currency Currency
+}
+
+// String formats `m` using the exponent of its currency, as in "12.50 EUR".
+func (m Money) String() string {
+	e := m.Currency.Exponent()
+	if e <= 0 {
+		return fmt.Sprintf("%d %s", m.Value, m.Currency)
+	}
+	s := fmt.Sprintf("%0*d", e+1, m.Value)
+	return fmt.Sprintf("%s.%s %s", s[:len(s)-e], s[len(s)-e:], m.Currency)
+}
+
+// Add returns `m + other`, or a CurrencyMismatch error.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, CurrencyMismatch{m.Currency, other.Currency}
+	}
+	return Money{m.Value + other.Value, m.Currency}, nil
+}
+
+// Sub returns `m - other`, or an error if the currencies differ
+// or if the result would be negative.
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, CurrencyMismatch{m.Currency, other.Currency}
+	}
+	if other.Value > m.Value {
+		return Money{}, fmt.Errorf("can't subtract %s from %s", other, m)
+	}
+	return Money{m.Value - other.Value, m.Currency}, nil
+}
+
+// Sum adds all the `amounts`, which must share the same currency.
+// An empty list returns the zero Money.
+func Sum(amounts ...Money) (Money, error) {
+	if len(amounts) == 0 {
+		return Money{}, nil
+	}
+	total := amounts[0]
+	for _, a := range amounts[1:] {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// Total returns the amount of the payment.
+func (p Payment) Total() Money { return Money{p.Amount, p.Currency} }
+
+// Refunded returns the amount already refunded.
+func (p Payment) Refunded() Money { return Money{p.AmountRefunded, p.Currency} }
+
+// Refundable returns the amount which may still be refunded.
+func (p Payment) Refundable() (Money, error) { return p.Total().Sub(p.Refunded()) }
+
+// Total returns the amount of the refund.
+func (r Refund) Total() Money { return Money{r.Amount, r.Currency} }
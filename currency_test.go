@@ -0,0 +1,53 @@
+package payplug
+
+import "testing"
+
+func TestMoneyString(t *testing.T) {
+	for _, test := range []struct {
+		m   Money
+		exp string
+	}{
+		{Money{1250, Eur}, "12.50 EUR"},
+		{Money{5, Eur}, "0.05 EUR"},
+		{Money{1250, "JPY"}, "1250 JPY"},
+		{Money{12345, "KWD"}, "12.345 KWD"},
+	} {
+		if got := test.m.String(); got != test.exp {
+			t.Errorf("expected %s, got %s", test.exp, got)
+		}
+	}
+}
+
+func TestMoneyMismatch(t *testing.T) {
+	_, err := Sum(Money{100, Eur}, Money{200, Eur}, Money{300, Usd})
+	if _, ok := err.(CurrencyMismatch); !ok {
+		t.Fatalf("expected CurrencyMismatch, got %v", err)
+	}
+	total, err := Sum(Money{100, Eur}, Money{200, Eur})
+	if err != nil || total != (Money{300, Eur}) {
+		t.Fatalf("unexpected sum %v (%v)", total, err)
+	}
+	p := Payment{Amount: 1000, AmountRefunded: 400, Currency: Eur}
+	if r, err := p.Refundable(); err != nil || r.Value != 600 {
+		t.Fatalf("unexpected refundable %v (%v)", r, err)
+	}
+}
+
+func TestValidateAmount(t *testing.T) {
+	if err := Currency("XYZ").ValidateAmount(1000); err == nil {
+		t.Fatal("expected error for unknown currency")
+	}
+	if err := Eur.ValidateAmount(50); err == nil {
+		t.Fatal("expected error for amount below minimum")
+	}
+	if err := Eur.ValidateAmount(1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := Usd.ValidateAmount(10); err != nil { // no limits
+		t.Fatal(err)
+	}
+	_, err := NewSession("").CreatePayment(Payment{Amount: 1000, Currency: "eur"})
+	if _, ok := err.(ValidationError); !ok {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package payplug
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
@@ -14,24 +15,58 @@ var (
 // Raised when there was an unrecoverable error during the request.
 // This is not an unexpected HTTP response code.
 type ClientError struct {
-	err error
+	err       error
+	transport bool // the request may have failed before reaching PayPlug, and may be retried
 }
 
+// NewClientError wraps `err`, mainly to simulate failures in tests.
+func NewClientError(err error) ClientError { return ClientError{err: err} }
+
 func (c ClientError) Error() string {
 	return fmt.Sprintf("error during request: %s", c.err)
 }
 
+func (c ClientError) Unwrap() error { return c.err }
+
 // HttpError indicates that the server responded with an error code.
 type HttpError struct {
-	code int
-	err  string
+	code       int
+	err        string
+	retryAfter time.Duration // requested by 429 and 503 responses
 }
 
+// NewHttpError returns the error for a response with status `code`
+// and content `body`, mainly to simulate failures in tests.
+func NewHttpError(code int, body string) HttpError { return HttpError{code: code, err: body} }
+
+// StatusCode returns the HTTP status of the response.
+func (h HttpError) StatusCode() int { return h.code }
+
 func (h HttpError) Error() string {
 	return fmt.Sprintf("%s: the server gave the following response: `%s`.",
 		mapHttpStatusToString(h.code), h.err)
 }
 
+// ValidationError is raised before sending a request,
+// when its content is known to be invalid.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (v ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", v.Field, v.Reason)
+}
+
+// CurrencyMismatch is raised when combining amounts of different currencies.
+type CurrencyMismatch struct {
+	A, B Currency
+}
+
+func (c CurrencyMismatch) Error() string {
+	return fmt.Sprintf("can't combine amounts in %s and %s", c.A, c.B)
+}
+
 func mapHttpStatusToString(code int) string {
 	switch code {
 	case 400:
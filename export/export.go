@@ -0,0 +1,211 @@
+// Package export dumps PayPlug payments and refunds to CSV or JSON Lines.
+//
+// Objects are flattened into columns named after their JSON fields,
+// nested objects using dotted names: "billing.email", "failure.code",
+// "metadata.order_id", etc.
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+// Format is the output format of an export.
+type Format uint8
+
+const (
+	CSV   Format = iota // Comma separated values, with a header line
+	JSONL               // One JSON object per line
+)
+
+// DefaultColumns is used when Options.Columns is empty.
+var DefaultColumns = []string{
+	"object", "id", "payment_id", "is_live", "created_at", "amount", "amount_refunded", "currency",
+	"is_paid", "paid_at", "is_refunded", "failure.code", "failure.message",
+	"billing.email", "billing.first_name", "billing.last_name", "billing.country",
+}
+
+// piiFields are the fields (last part of the column name)
+// hidden when redacting.
+var piiFields = map[string]bool{
+	"email": true, "first_name": true, "last_name": true, "company_name": true,
+	"mobile_phone_number": true, "landline_phone_number": true,
+	"address1": true, "address2": true, "postcode": true, "city": true,
+}
+
+const redacted = "[redacted]"
+
+// Options configures an export.
+type Options struct {
+	Format  Format
+	Columns []string // Flattened field names, in output order
+	Redact  bool     // Hide personal data (names, emails, phones, addresses)
+}
+
+func (o Options) columns() []string {
+	if len(o.Columns) == 0 {
+		return DefaultColumns
+	}
+	return o.Columns
+}
+
+// Writer writes flattened objects to an underlying writer.
+// Close must be called to flush the output.
+type Writer struct {
+	opts    Options
+	columns []string
+	csv     *csv.Writer
+	json    *json.Encoder
+	header  bool
+}
+
+// NewWriter returns a Writer using `opts`.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	out := &Writer{opts: opts, columns: opts.columns()}
+	switch opts.Format {
+	case JSONL:
+		out.json = json.NewEncoder(w)
+	default:
+		out.csv = csv.NewWriter(w)
+	}
+	return out
+}
+
+// flatten converts the JSON representation of `v` into
+// a flat map from dotted names to JSON values: strings, booleans,
+// json.Number and arrays.
+func flatten(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber() // keep the integers as is
+	var tree map[string]interface{}
+	if err = dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	out := map[string]interface{}{}
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, child := range v {
+				walk(prefix+k+".", child)
+			}
+		case nil:
+		default:
+			out[strings.TrimSuffix(prefix, ".")] = v
+		}
+	}
+	walk("", tree)
+	return out, nil
+}
+
+// csvValue formats a value returned by flatten
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default: // arrays
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+func (w *Writer) write(v interface{}) error {
+	fields, err := flatten(v)
+	if err != nil {
+		return err
+	}
+	for _, col := range w.columns {
+		if w.opts.Redact && csvValue(fields[col]) != "" && piiFields[col[strings.LastIndexByte(col, '.')+1:]] {
+			fields[col] = redacted
+		}
+	}
+
+	if w.json != nil {
+		obj := make(map[string]interface{}, len(w.columns))
+		for _, col := range w.columns {
+			if v, ok := fields[col]; ok {
+				obj[col] = v
+			}
+		}
+		return w.json.Encode(obj)
+	}
+	if !w.header {
+		w.header = true
+		if err := w.csv.Write(w.columns); err != nil {
+			return err
+		}
+	}
+	row := make([]string, len(w.columns))
+	for i, col := range w.columns {
+		row[i] = csvValue(fields[col])
+	}
+	return w.csv.Write(row)
+}
+
+// WritePayment writes one line for `p`.
+func (w *Writer) WritePayment(p payplug.Payment) error { return w.write(p) }
+
+// WriteRefund writes one line for `r`.
+func (w *Writer) WriteRefund(r payplug.Refund) error { return w.write(r) }
+
+// Close flushes the output. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.csv == nil {
+		return nil
+	}
+	if !w.header { // always write the header, even without rows
+		w.header = true
+		if err := w.csv.Write(w.columns); err != nil {
+			return err
+		}
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// Export streams the payments created between `from` and `to` (inclusive),
+// each one followed by all its refunds, to `w`.
+// Since PayPlug only lists refunds by payment, the refunds made in the range
+// for payments created before `from` are not exported.
+func Export(w io.Writer, s payplug.Client, from, to payplug.Timestamp, opts Options) error {
+	out := NewWriter(w, opts)
+	err := s.WalkPayments(from, to, func(p payplug.Payment) error {
+		if err := out.WritePayment(p); err != nil {
+			return err
+		}
+		if p.AmountRefunded == 0 {
+			return nil
+		}
+		refunds, err := s.ListRefunds(p.Id)
+		if err != nil {
+			return fmt.Errorf("listing refunds of %s: %s", p.Id, err)
+		}
+		for _, r := range refunds.Data {
+			if err := out.WriteRefund(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,74 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+func TestExport(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/refunds") {
+			json.NewEncoder(w).Encode(payplug.RefundList{Data: []payplug.Refund{
+				{Id: "re_1", PaymentId: "pay_2", Object: "refund", Amount: 300, Currency: payplug.Eur, CreatedAt: 1500},
+			}})
+			return
+		}
+		json.NewEncoder(w).Encode(payplug.PaymentList{Data: []payplug.Payment{
+			{Id: "pay_3", CreatedAt: 1500000000},
+			{
+				Id: "pay_2", Object: "payment", CreatedAt: 1434010787, Amount: 3300, AmountRefunded: 300, Currency: payplug.Eur,
+				Billing:  payplug.Billing{Email: "john.watson@example.net", Country: "GB"},
+				Failure:  payplug.OptionnalFailure{Valid: true, Failure: payplug.Failure{Code: payplug.Timeout}},
+				Metadata: payplug.Metadata{"order_id": 42.},
+			},
+			{Id: "pay_1", CreatedAt: 10},
+		}})
+	}))
+	defer api.Close()
+	s := payplug.NewSession("sk_test")
+	s.SetBaseUrl(api.URL)
+
+	var buf bytes.Buffer
+	opts := Options{Columns: []string{"object", "id", "payment_id", "amount", "failure.code", "billing.email", "metadata.order_id"}, Redact: true}
+	if err := Export(&buf, s, 100, 1434010787, opts); err != nil {
+		t.Fatal(err)
+	}
+	exp := `object,id,payment_id,amount,failure.code,billing.email,metadata.order_id
+payment,pay_2,,3300,timeout,[redacted],42
+refund,re_1,pay_2,300,,,
+`
+	if buf.String() != exp {
+		t.Fatalf("expected\n%s\ngot\n%s", exp, buf.String())
+	}
+
+	buf.Reset()
+	opts.Format, opts.Redact = JSONL, false
+	if err := Export(&buf, s, 100, 1434010787, opts); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"billing.email":"john.watson@example.net"`) {
+		t.Fatalf("unexpected output %s", buf.String())
+	}
+	// values keep their JSON type
+	if !strings.Contains(lines[0], `"amount":3300`) || !strings.Contains(lines[0], `"metadata.order_id":42`) {
+		t.Fatalf("unexpected output %s", lines[0])
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestCloseError(t *testing.T) {
+	if err := NewWriter(failingWriter{}, Options{}).Close(); err == nil {
+		t.Fatal("expected error when writing the header")
+	}
+}
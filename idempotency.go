@@ -0,0 +1,294 @@
+package payplug
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyMetadataKey is the metadata key tagging the objects
+// created with an idempotency key, used to find them back
+// when the response of a creation was lost.
+const IdempotencyMetadataKey = "idempotency_key"
+
+// idempotencyHeader is sent when Session.SetIdempotencyStore is called
+// with `sendHeader`
+const idempotencyHeader = "Idempotency-Key"
+
+// recovery margin, accounting for clock differences with PayPlug
+const idempotencyClockSkew = 5 * 60
+
+// IdempotencyLease is the duration after which a running attempt
+// is assumed dead (for instance because its process crashed), so that
+// an other call may take over the key.
+const IdempotencyLease = 10 * time.Minute
+
+// ErrIdempotencyInProgress is returned when an other call
+// with the same key is running.
+var ErrIdempotencyInProgress = errors.New("an other call with the same idempotency key is in progress")
+
+// ErrIdempotencyClaimLost is returned by IdempotencyStore.Save when
+// an other call took over the key, for instance after the lease expired.
+var ErrIdempotencyClaimLost = errors.New("the idempotency key was claimed by an other call")
+
+// IdempotencyRecord is the state of a creation call.
+type IdempotencyRecord struct {
+	StartedAt Timestamp       // Start of the first attempt
+	ClaimedAt Timestamp       // Start of the running attempt, zero when no attempt is running
+	Attempts  int             // Number of attempts, including the running one
+	Response  json.RawMessage // The created object, nil while the outcome is unknown
+}
+
+// claimable returns true if the outcome of `r` is unknown and
+// no attempt is running since `staleBefore`
+func (r IdempotencyRecord) claimable(staleBefore Timestamp) bool {
+	return r.Response == nil && r.ClaimedAt < staleBefore
+}
+
+// IdempotencyStore remembers the results of creation calls by key.
+// Implementations must be safe for concurrent use, including
+// by several processes sharing the store.
+type IdempotencyStore interface {
+	// Claim atomically starts an attempt for `key`: it creates the record
+	// if there is none, or, if the outcome of the previous attempts is unknown
+	// and none is running (its ClaimedAt is zero or older than `lease`),
+	// sets ClaimedAt to now and increments Attempts.
+	// It returns the resulting record and true if the attempt is started,
+	// or the existing record and false otherwise.
+	Claim(key string, lease time.Duration) (IdempotencyRecord, bool, error)
+	// Save updates the record of the attempt started by Claim, which is
+	// identified by `record.Attempts`. It returns ErrIdempotencyClaimLost
+	// if the stored record has an other attempt, a response, or was released.
+	Save(key string, record IdempotencyRecord) error
+	// Release deletes the record for `key`, when no object was created.
+	Release(key string) error
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore keeping the records in memory,
+// which only protects retries made by the same process.
+// The zero value is ready to use.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]IdempotencyRecord
+}
+
+// Load returns the record for `key`, and false if there is none.
+func (m *MemoryIdempotencyStore) Load(key string) (IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.records[key]
+	return r, ok, nil
+}
+
+func (m *MemoryIdempotencyStore) Claim(key string, lease time.Duration) (IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.records == nil {
+		m.records = make(map[string]IdempotencyRecord)
+	}
+	now := time.Now()
+	r, ok := m.records[key]
+	if !ok {
+		r = IdempotencyRecord{StartedAt: Timestamp(now.Unix())}
+	} else if !r.claimable(Timestamp(now.Add(-lease).Unix())) {
+		return r, false, nil
+	}
+	r.ClaimedAt = Timestamp(now.Unix())
+	r.Attempts++
+	m.records[key] = r
+	return r, true, nil
+}
+
+func (m *MemoryIdempotencyStore) Save(key string, record IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.records[key]
+	if !ok || current.Attempts != record.Attempts || current.Response != nil {
+		return ErrIdempotencyClaimLost
+	}
+	m.records[key] = record
+	return nil
+}
+
+func (m *MemoryIdempotencyStore) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+	return nil
+}
+
+// SetIdempotencyStore enables the idempotent creation calls.
+// If `sendHeader` is true, the key is also sent in the Idempotency-Key header,
+// for API versions supporting it.
+func (s *Session) SetIdempotencyStore(store IdempotencyStore, sendHeader bool) {
+	s.idempotency = store
+	s.sendIdempotencyHeader = sendHeader
+}
+
+// rejected returns true if `err` proves that no object was created
+func rejected(err error) bool {
+	var (
+		v ValidationError
+		h HttpError
+	)
+	if errors.As(err, &v) {
+		return true
+	}
+	return errors.As(err, &h) && 400 <= h.code && h.code < 500 &&
+		h.code != http.StatusRequestTimeout && h.code != http.StatusTooManyRequests
+}
+
+// idempotent implements the idempotency protocol for a creation call:
+//   - a known result is returned as is
+//   - if an other attempt is running, ErrIdempotencyInProgress is returned
+//   - if a previous attempt has an unknown outcome, `find` looks for the object
+//     tagged with `key` on PayPlug
+//   - otherwise, `create` is called and its result saved
+func (s Session) idempotent(key string, out interface{}, find func(since Timestamp) (interface{}, bool, error), create func(header http.Header) (interface{}, error)) error {
+	if s.idempotency == nil {
+		return errors.New("idempotency store not set (see SetIdempotencyStore)")
+	}
+	if key == "" {
+		return ValidationError{Field: "idempotency key", Reason: "empty key"}
+	}
+	record, claimed, err := s.idempotency.Claim(key, IdempotencyLease)
+	if err != nil {
+		return fmt.Errorf("claiming idempotency key: %s", err)
+	}
+	if record.Response != nil {
+		return json.Unmarshal(record.Response, out)
+	}
+	if !claimed {
+		return ErrIdempotencyInProgress
+	}
+
+	if record.Attempts > 1 { // previous attempt with unknown outcome
+		since := record.StartedAt
+		if since > idempotencyClockSkew {
+			since -= idempotencyClockSkew
+		}
+		v, found, err := find(since)
+		if err != nil {
+			s.unclaim(key, record)
+			return fmt.Errorf("looking for a previous attempt: %s", err)
+		}
+		if found {
+			return s.saveIdempotent(key, record, v, out)
+		}
+	}
+
+	var header http.Header
+	if s.sendIdempotencyHeader {
+		header = http.Header{}
+		header.Set(idempotencyHeader, key)
+	}
+	v, err := create(header)
+	if err != nil {
+		if rejected(err) && record.Attempts == 1 {
+			if errRelease := s.idempotency.Release(key); errRelease != nil {
+				return fmt.Errorf("%s (releasing idempotency key: %s)", err, errRelease)
+			}
+		} else {
+			s.unclaim(key, record)
+		}
+		return err
+	}
+	return s.saveIdempotent(key, record, v, out)
+}
+
+// unclaim marks the running attempt as finished, with an unknown outcome,
+// so that the next call may proceed without waiting for the lease
+func (s Session) unclaim(key string, record IdempotencyRecord) {
+	record.ClaimedAt = 0
+	s.idempotency.Save(key, record) // on error, the lease expires anyway, or the key was taken over
+}
+
+func (s Session) saveIdempotent(key string, record IdempotencyRecord, v, out interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	record.ClaimedAt, record.Response = 0, b
+	if err = s.idempotency.Save(key, record); err != nil {
+		return fmt.Errorf("saving idempotency record: %s", err)
+	}
+	return json.Unmarshal(b, out)
+}
+
+// withIdempotencyKey returns a copy of `m` with the idempotency key.
+// Since the key uses a metadata entry, `m` must have at most
+// MetadataMaxKeys - 1 other keys.
+func withIdempotencyKey(m Metadata, key string) (Metadata, error) {
+	out := make(Metadata, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	out[IdempotencyMetadataKey] = key
+	if len(out) > MetadataMaxKeys {
+		return nil, ValidationError{Field: "metadata", Reason: fmt.Sprintf("%d keys, but idempotent calls use one of the %d keys available", len(m), MetadataMaxKeys)}
+	}
+	return out, out.Validate()
+}
+
+// CreatePaymentIdempotent is the same as CreatePayment, but may be safely
+// retried with the same `key`: the payment is created at most once, and
+// retries return it.
+// The key is stored in the metadata of the payment, so that a payment
+// created by an attempt whose response was lost is found back.
+// Concurrent calls with the same key return ErrIdempotencyInProgress.
+func (s Session) CreatePaymentIdempotent(key string, payment Payment) (Payment, error) {
+	var err error
+	if payment.Metadata, err = withIdempotencyKey(payment.Metadata, key); err != nil {
+		return Payment{}, err
+	}
+	if err = s.validatePayment(payment); err != nil { // before claiming the key
+		return Payment{}, err
+	}
+	var out Payment
+	err = s.idempotent(key, &out, func(since Timestamp) (interface{}, bool, error) {
+		var found *Payment
+		errFound := errors.New("found")
+		err := s.WalkPayments(since, Timestamp(time.Now().Unix()+idempotencyClockSkew), func(p Payment) error {
+			if p.Metadata[IdempotencyMetadataKey] == key {
+				found = &p
+				return errFound
+			}
+			return nil
+		})
+		if found != nil {
+			return *found, true, nil
+		}
+		return nil, false, err
+	}, func(header http.Header) (interface{}, error) {
+		return s.createPayment(payment, header)
+	})
+	return out, err
+}
+
+// CreateRefundIdempotent is the same as CreateRefund, but may be safely
+// retried with the same `key`, as CreatePaymentIdempotent.
+func (s Session) CreateRefundIdempotent(key string, paymentId string, refund Refund) (Refund, error) {
+	var err error
+	if refund.Metadata, err = withIdempotencyKey(refund.Metadata, key); err != nil {
+		return Refund{}, err
+	}
+	var out Refund
+	err = s.idempotent(key, &out, func(since Timestamp) (interface{}, bool, error) {
+		list, err := s.ListRefunds(paymentId)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, r := range list.Data {
+			if r.Metadata[IdempotencyMetadataKey] == key {
+				return r, true, nil
+			}
+		}
+		return nil, false, nil
+	}, func(header http.Header) (interface{}, error) {
+		return s.createRefund(paymentId, refund, header)
+	})
+	return out, err
+}
@@ -0,0 +1,216 @@
+package payplug
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCreatePaymentIdempotent(t *testing.T) {
+	var (
+		created  []Payment
+		loseNext = true
+	)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			if r.Header.Get(idempotencyHeader) != "order-42" {
+				t.Errorf("missing idempotency header")
+			}
+			var p Payment
+			json.NewDecoder(r.Body).Decode(&p)
+			p.Id, p.CreatedAt = "pay_1", Timestamp(time.Now().Unix())
+			created = append(created, p)
+			if loseNext { // the payment is created, but the response is lost
+				loseNext = false
+				http.Error(w, "{}", http.StatusGatewayTimeout)
+				return
+			}
+			json.NewEncoder(w).Encode(p)
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(PaymentList{Data: created})
+		}
+	}))
+	defer api.Close()
+
+	s := NewSession("sk_test")
+	s.SetBaseUrl(api.URL)
+	if _, err := s.CreatePaymentIdempotent("order-42", Payment{}); err == nil {
+		t.Fatal("expected error when the idempotency store is not set")
+	}
+	s.SetIdempotencyStore(new(MemoryIdempotencyStore), true)
+
+	payment := Payment{Amount: 1000, Currency: Eur, Metadata: Metadata{"order": "42"}}
+	if _, err := s.CreatePaymentIdempotent("order-42", payment); err == nil {
+		t.Fatal("expected error for the lost response")
+	}
+	if _, ok := payment.Metadata[IdempotencyMetadataKey]; ok {
+		t.Fatal("caller metadata should not be modified")
+	}
+	for range [2]int{} { // retries
+		p, err := s.CreatePaymentIdempotent("order-42", payment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Id != "pay_1" || p.Metadata["order"] != "42" {
+			t.Fatalf("unexpected payment %+v", p)
+		}
+	}
+	if len(created) != 1 {
+		t.Fatalf("expected a single payment, got %d", len(created))
+	}
+}
+
+func TestMemoryIdempotencyClaim(t *testing.T) {
+	var store MemoryIdempotencyStore
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed int
+	)
+	for range [20]int{} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, _ := store.Claim("k", time.Minute)
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				claimed++
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Fatalf("expected a single claim, got %d", claimed)
+	}
+
+	r, _, _ := store.Load("k")
+	r.ClaimedAt = 0 // attempt finished, with unknown outcome
+	store.Save("k", r)
+	if r, ok, _ := store.Claim("k", time.Minute); !ok || r.Attempts != 2 {
+		t.Fatalf("expected a second attempt, got %v %+v", ok, r)
+	}
+	// a running attempt is taken over once its lease expired
+	r, ok, _ := store.Claim("k", -time.Minute)
+	if !ok || r.Attempts != 3 {
+		t.Fatalf("expected a third attempt, got %v %+v", ok, r)
+	}
+	stale := r
+	stale.Attempts, stale.Response = 2, json.RawMessage(`{"id":"pay_2"}`)
+	if err := store.Save("k", stale); err != ErrIdempotencyClaimLost {
+		t.Fatalf("expected lost claim, got %v", err)
+	}
+
+	r.Response = json.RawMessage(`{}`)
+	if err := store.Save("k", r); err != nil {
+		t.Fatal(err)
+	}
+	if r, ok, _ := store.Claim("k", -time.Minute); ok || r.Response == nil {
+		t.Fatalf("a finished call should not be claimed")
+	}
+}
+
+func TestIdempotentRejected(t *testing.T) {
+	var posts int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		if posts == 1 {
+			http.Error(w, "{}", http.StatusBadRequest)
+			return
+		}
+		var p Payment
+		json.NewDecoder(r.Body).Decode(&p)
+		p.Id = "pay_1"
+		json.NewEncoder(w).Encode(p)
+	}))
+	defer api.Close()
+
+	s := NewSession("sk_test")
+	s.SetBaseUrl(api.URL)
+	store := new(MemoryIdempotencyStore)
+	s.SetIdempotencyStore(store, false)
+
+	// rejected before claiming the key
+	if _, err := s.CreatePaymentIdempotent("order-1", Payment{Amount: 0, Currency: Eur}); err == nil {
+		t.Fatal("expected validation error")
+	}
+	metadata := Metadata{}
+	for i := 0; i < MetadataMaxKeys; i++ {
+		metadata[fmt.Sprintf("key%d", i)] = "v"
+	}
+	_, err := s.CreatePaymentIdempotent("order-1", Payment{Amount: 1000, Currency: Eur, Metadata: metadata})
+	var v ValidationError
+	if !errors.As(err, &v) || v.Field != "metadata" {
+		t.Fatalf("expected metadata validation error, got %v", err)
+	}
+	if _, ok, _ := store.Load("order-1"); ok {
+		t.Fatal("validation errors should not claim the key")
+	}
+
+	// rejected by PayPlug: the key is released
+	if _, err := s.CreatePaymentIdempotent("order-1", Payment{Amount: 1000, Currency: Eur}); err == nil {
+		t.Fatal("expected HTTP error")
+	}
+	if _, ok, _ := store.Load("order-1"); ok {
+		t.Fatal("rejected calls should release the key")
+	}
+	p, err := s.CreatePaymentIdempotent("order-1", Payment{Amount: 1000, Currency: Eur})
+	if err != nil || p.Id != "pay_1" {
+		t.Fatalf("unexpected %+v %v", p, err)
+	}
+}
+
+func TestCreateRefundIdempotent(t *testing.T) {
+	var (
+		created  []Refund
+		loseNext = true
+	)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/payments/pay_1/refunds" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		switch r.Method {
+		case http.MethodPost:
+			var rf Refund
+			json.NewDecoder(r.Body).Decode(&rf)
+			rf.Id, rf.PaymentId = "re_1", "pay_1"
+			created = append(created, rf)
+			if loseNext {
+				loseNext = false
+				http.Error(w, "{}", http.StatusBadGateway)
+				return
+			}
+			json.NewEncoder(w).Encode(rf)
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(RefundList{Data: created})
+		}
+	}))
+	defer api.Close()
+
+	s := NewSession("sk_test")
+	s.SetBaseUrl(api.URL)
+	s.SetIdempotencyStore(new(MemoryIdempotencyStore), false)
+
+	refund := Refund{Amount: 500}
+	if _, err := s.CreateRefundIdempotent("refund-1", "pay_1", refund); err == nil {
+		t.Fatal("expected error for the lost response")
+	}
+	for range [2]int{} {
+		r, err := s.CreateRefundIdempotent("refund-1", "pay_1", refund)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Id != "re_1" || r.Metadata[IdempotencyMetadataKey] != "refund-1" {
+			t.Fatalf("unexpected refund %+v", r)
+		}
+	}
+	if len(created) != 1 {
+		t.Fatalf("expected a single refund, got %d", len(created))
+	}
+}
@@ -0,0 +1,151 @@
+package payplug
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyProvider supplies the secret key, which is asked
+// before every request, so that keys may be rotated
+// without rebuilding the sessions.
+// Implementations must be safe for concurrent use.
+type KeyProvider interface {
+	// Key returns the current secret key.
+	Key() (string, error)
+	// Refresh is called when the API rejects the key `rejected` (401 response),
+	// before retrying the request once. It may do nothing if the current
+	// key is already different.
+	Refresh(rejected string) error
+}
+
+// StaticKey is a KeyProvider always returning the same key.
+type StaticKey string
+
+func (k StaticKey) Key() (string, error) { return string(k), nil }
+
+func (k StaticKey) Refresh(string) error { return nil }
+
+// EnvKey is a KeyProvider reading the environment variable
+// with this name on every request.
+type EnvKey string
+
+func (k EnvKey) Key() (string, error) { return os.Getenv(string(k)), nil }
+
+func (k EnvKey) Refresh(string) error { return nil }
+
+// FileKey is a KeyProvider reading the key from a file, which
+// is read again when its modification time changes.
+// Surrounding spaces are ignored.
+type FileKey struct {
+	path string
+
+	mu      sync.Mutex
+	key     string
+	modTime time.Time
+}
+
+// NewFileKey returns a provider reading the key from `path`.
+func NewFileKey(path string) *FileKey { return &FileKey{path: path} }
+
+func (f *FileKey) Key() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("reading secret key: %s", err)
+	}
+	if f.key != "" && info.ModTime().Equal(f.modTime) {
+		return f.key, nil
+	}
+	return f.load(info.ModTime())
+}
+
+// Refresh reads the file again, even if it seems unchanged,
+// unless the key was already reloaded since `rejected` was read.
+func (f *FileKey) Refresh(rejected string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.key != rejected {
+		return nil
+	}
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("reading secret key: %s", err)
+	}
+	_, err = f.load(info.ModTime())
+	return err
+}
+
+// load must be called with the lock held
+func (f *FileKey) load(modTime time.Time) (string, error) {
+	b, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("reading secret key: %s", err)
+	}
+	f.key, f.modTime = strings.TrimSpace(string(b)), modTime
+	return f.key, nil
+}
+
+// SetKeyProvider replaces the secret key of the session by `keys`.
+func (s *Session) SetKeyProvider(keys KeyProvider) {
+	s.keys = keys
+}
+
+// sessionKeys is implemented by the providers requesting their keys
+// with the HTTP client and the base URL of the session, such as
+// ClientCredentials. They are passed on each call, so that the
+// provider may be shared by several sessions.
+type sessionKeys interface {
+	sessionKey(client *http.Client, baseUrl string) (string, error)
+	sessionRefresh(client *http.Client, baseUrl string, rejected string) error
+}
+
+// WithKeyProvider is the same as Session.SetKeyProvider.
+func WithKeyProvider(keys KeyProvider) Option {
+	return func(c *config) { c.session.SetKeyProvider(keys) }
+}
+
+// secretKey returns the current key of the session
+func (s Session) secretKey() (string, error) {
+	if s.keys == nil {
+		return "", SecretKeyNotSet
+	}
+	if s.configErr != nil {
+		return "", s.configErr // the client of the session may not be used
+	}
+	var (
+		key string
+		err error
+	)
+	if p, ok := s.keys.(sessionKeys); ok {
+		key, err = p.sessionKey(s.client, s.baseUrl)
+	} else {
+		key, err = s.keys.Key()
+	}
+	if err != nil {
+		return "", ClientError{err: err}
+	}
+	if key == "" {
+		return "", SecretKeyNotSet
+	}
+	return key, nil
+}
+
+// refreshKey refreshes the key `rejected` by the API
+func (s Session) refreshKey(rejected string) error {
+	if p, ok := s.keys.(sessionKeys); ok {
+		return p.sessionRefresh(s.client, s.baseUrl, rejected)
+	}
+	return s.keys.Refresh(rejected)
+}
+
+// refreshableKey returns false if refreshing the key is useless
+func (s Session) refreshableKey() bool {
+	_, static := s.keys.(StaticKey)
+	return s.keys != nil && !static
+}
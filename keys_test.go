@@ -0,0 +1,64 @@
+package payplug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFileKeyRotation(t *testing.T) {
+	var calls int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Header.Get("Authorization") != "Bearer sk_test_new" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(Payment{Id: "pay_1"})
+	}))
+	defer api.Close()
+
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, []byte("sk_test_old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys := NewFileKey(path)
+	s := NewSession("", WithBaseUrl(api.URL), WithKeyProvider(keys))
+	if _, err := s.GetPayment("pay_1"); err == nil {
+		t.Fatal("expected 401 error")
+	}
+	if calls != 2 {
+		t.Fatalf("expected one retry, got %d calls", calls)
+	}
+
+	// the modification time may be unchanged: the refresh triggered by the 401 reloads the file
+	if err := os.WriteFile(path, []byte("sk_test_new\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	calls = 0
+	if _, err := s.GetPayment("pay_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetPayment("pay_1"); err != nil {
+		t.Fatal(err)
+	}
+	if calls > 3 {
+		t.Fatalf("unexpected number of calls: %d", calls)
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	t.Setenv("PAYPLUG_TEST_KEY", "")
+	s := NewSession("", WithKeyProvider(EnvKey("PAYPLUG_TEST_KEY")))
+	if _, err := s.GetPayment("pay_1"); err != SecretKeyNotSet {
+		t.Fatalf("expected SecretKeyNotSet, got %v", err)
+	}
+	t.Setenv("PAYPLUG_TEST_KEY", "sk_test")
+	if key, _ := s.secretKey(); key != "sk_test" {
+		t.Fatalf("unexpected key %s", key)
+	}
+}
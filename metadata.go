@@ -0,0 +1,200 @@
+package payplug
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits enforced by PayPlug on metadata.
+const (
+	MetadataMaxKeys        = 10
+	MetadataMaxKeyLength   = 20
+	MetadataMaxValueLength = 500
+)
+
+// Validate checks that `m` respects the PayPlug limits on
+// key count, key length and value length.
+func (m Metadata) Validate() error {
+	if len(m) > MetadataMaxKeys {
+		return ValidationError{Field: "metadata", Reason: fmt.Sprintf("%d keys (maximum is %d)", len(m), MetadataMaxKeys)}
+	}
+	for k, v := range m {
+		if utf8.RuneCountInString(k) > MetadataMaxKeyLength {
+			return ValidationError{Field: "metadata", Reason: fmt.Sprintf("key %q is longer than %d characters", k, MetadataMaxKeyLength)}
+		}
+		if s := fmt.Sprint(v); utf8.RuneCountInString(s) > MetadataMaxValueLength {
+			return ValidationError{Field: "metadata", Reason: fmt.Sprintf("value of %q is longer than %d characters", k, MetadataMaxValueLength)}
+		}
+	}
+	return nil
+}
+
+// metadataField is a struct field mapped to a metadata key
+type metadataField struct {
+	index     int
+	key       string
+	omitEmpty bool
+}
+
+// metadataFields parses the `metadata` tags of `t`, which must be a struct type.
+// Untagged exported fields use their name as key, and the "-" tag skips a field.
+func metadataFields(t reflect.Type) ([]metadataField, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("metadata: expected a struct, got %s", t)
+	}
+	var out []metadataField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("metadata")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		out = append(out, metadataField{index: i, key: name, omitEmpty: opts == "omitempty"})
+	}
+	return out, nil
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// EncodeMetadata converts the struct `v` into Metadata.
+// Fields are mapped using the `metadata:"key[,omitempty]"` tag.
+// Every value is stored as a string, so that integers keep their
+// full precision through JSON.
+// Supported field types are strings, booleans, numbers and
+// encoding.TextMarshaler implementations.
+// The result is checked with Metadata.Validate.
+func EncodeMetadata[T any](v T) (Metadata, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, errors.New("metadata: expected a struct, got nil")
+	}
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("metadata: expected a struct, got nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("metadata: expected a struct, got %s", rv.Type())
+	}
+	fields, err := metadataFields(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	out := Metadata{}
+	for _, f := range fields {
+		fv := rv.Field(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		s, err := encodeMetadataValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("metadata: field %s: %s", f.key, err)
+		}
+		out[f.key] = s
+	}
+	return out, out.Validate()
+}
+
+func encodeMetadataValue(v reflect.Value) (string, error) {
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// DecodeMetadata is the inverse of EncodeMetadata.
+// Values may be strings (as written by EncodeMetadata) or
+// plain JSON values. Missing keys leave the field to its zero value.
+func DecodeMetadata[T any](m Metadata) (T, error) {
+	var out T
+	rv := reflect.ValueOf(&out).Elem()
+	fields, err := metadataFields(rv.Type())
+	if err != nil {
+		return out, err
+	}
+	for _, f := range fields {
+		raw, ok := m[f.key]
+		if !ok || raw == nil {
+			continue
+		}
+		var s string
+		switch raw := raw.(type) {
+		case string:
+			s = raw
+		case float64:
+			s = strconv.FormatFloat(raw, 'f', -1, 64)
+		default:
+			s = fmt.Sprint(raw)
+		}
+		if err := decodeMetadataValue(s, rv.Field(f.index)); err != nil {
+			return out, fmt.Errorf("metadata: key %s: %s", f.key, err)
+		}
+	}
+	return out, nil
+}
+
+func decodeMetadataValue(s string, v reflect.Value) error {
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
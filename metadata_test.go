@@ -0,0 +1,75 @@
+package payplug
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type orderMetadata struct {
+	OrderId  int64     `metadata:"order_id"`
+	Customer string    `metadata:"customer,omitempty"`
+	Gift     bool      `metadata:"gift"`
+	Date     time.Time `metadata:"date"`
+	internal int
+	Skipped  string `metadata:"-"`
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	in := orderMetadata{OrderId: 1<<62 + 1, Gift: true, Date: time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC), Skipped: "x"}
+	m, err := EncodeMetadata(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["customer"]; ok {
+		t.Fatal("empty customer should be omitted")
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Metadata
+	if err = json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	out, err := DecodeMetadata[orderMetadata](back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.Skipped = ""
+	if out != in {
+		t.Fatalf("expected %v, got %v", in, out)
+	}
+
+	// values set by other tools are plain JSON numbers
+	out, err = DecodeMetadata[orderMetadata](Metadata{"order_id": 42.})
+	if err != nil || out.OrderId != 42 {
+		t.Fatalf("unexpected %v (%v)", out, err)
+	}
+}
+
+func TestMetadataLimits(t *testing.T) {
+	m := Metadata{}
+	for i := 0; i < MetadataMaxKeys+1; i++ {
+		m[string(rune('a'+i))] = i
+	}
+	if err := m.Validate(); err == nil {
+		t.Fatal("expected error for too many keys")
+	}
+	if err := (Metadata{strings.Repeat("k", 21): 1}).Validate(); err == nil {
+		t.Fatal("expected error for long key")
+	}
+	if err := (Metadata{"k": strings.Repeat("v", 501)}).Validate(); err == nil {
+		t.Fatal("expected error for long value")
+	}
+	if _, err := EncodeMetadata(struct{ C chan int }{}); err == nil {
+		t.Fatal("expected error for unsupported type")
+	}
+	for _, v := range []interface{}{nil, (*struct{ A string })(nil), 3, map[string]string{}} {
+		if _, err := EncodeMetadata(v); err == nil || !strings.Contains(err.Error(), "expected a struct") {
+			t.Fatalf("expected error for %#v, got %v", v, err)
+		}
+	}
+}
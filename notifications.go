@@ -1,6 +1,7 @@
 package payplug
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -56,9 +57,78 @@ func (s Session) HandleNotificationAccountingReport(body io.Reader) (AccountingR
 	return r, err
 }
 
+// HandleNotificationInstallmentPlan reads the `body` of a notification,
+// and fetch the completed and trusted data from PayPlug.
+func (s Session) HandleNotificationInstallmentPlan(body io.Reader) (InstallmentPlan, error) {
+	var r InstallmentPlan
+	err := s.handleNotification(body, &r)
+	return r, err
+}
+
+// NotificationCallbacks receive the trusted objects of notifications,
+// by object type. A nil callback ignores the notifications of its type.
+type NotificationCallbacks struct {
+	Payment          func(Payment) error
+	Refund           func(Refund) error
+	AccountingReport func(AccountingReport) error
+	InstallmentPlan  func(InstallmentPlan) error
+}
+
+// NotificationObject returns the "object" field of a notification body,
+// which selects the HandleNotification* method to use.
+func NotificationObject(body []byte) (string, error) {
+	var head struct {
+		Object string `json:"object"`
+	}
+	if err := json.Unmarshal(body, &head); err != nil {
+		return "", unexpectedAPIResponseErr(err)
+	}
+	switch head.Object {
+	case "payment", "refund", "accounting_report", "installment_plan":
+		return head.Object, nil
+	}
+	return "", ValidationError{Field: "notification object", Reason: fmt.Sprintf("unsupported object %q", head.Object)}
+}
+
+// Dispatch fetches the trusted object of the notification `body`
+// with `client`, and passes it to the matching callback.
+func (c NotificationCallbacks) Dispatch(client Client, body []byte) error {
+	object, err := NotificationObject(body)
+	if err != nil {
+		return err
+	}
+	switch object {
+	case "payment":
+		p, err := client.HandleNotificationPayment(bytes.NewReader(body))
+		if err != nil || c.Payment == nil {
+			return err
+		}
+		return c.Payment(p)
+	case "refund":
+		r, err := client.HandleNotificationRefund(bytes.NewReader(body))
+		if err != nil || c.Refund == nil {
+			return err
+		}
+		return c.Refund(r)
+	case "accounting_report":
+		a, err := client.HandleNotificationAccountingReport(bytes.NewReader(body))
+		if err != nil || c.AccountingReport == nil {
+			return err
+		}
+		return c.AccountingReport(a)
+	default: // installment_plan
+		i, err := client.HandleNotificationInstallmentPlan(bytes.NewReader(body))
+		if err != nil || c.InstallmentPlan == nil {
+			return err
+		}
+		return c.InstallmentPlan(i)
+	}
+}
+
 // payment: Payment
 // refund: Refund
 // accounting_report: AccoutingReport
+// installment_plan: InstallmentPlan
 
 // not verifiable
 // customer: Customer
@@ -0,0 +1,210 @@
+package payplug
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokens are renewed a bit before their expiry,
+// to account for the request duration
+const tokenExpiryMargin = 30 * time.Second
+
+// ClientCredentials is a KeyProvider implementing the OAuth2
+// client credentials flow: the client ID and secret are exchanged
+// for an access token, which is cached until it expires.
+// Concurrent requests share the same token, and only one
+// token request is made at a time.
+// A provider may be shared by sessions with different base URLs:
+// tokens are cached by token URL.
+type ClientCredentials struct {
+	clientID, clientSecret string
+
+	TokenURL string       // default to the token resource of the session base URL, or OAUTH2_TOKEN_RESOURCE
+	Client   *http.Client // default to the client of the session, or http.DefaultClient
+
+	mu     sync.Mutex
+	tokens map[string]*cachedToken // by token URL
+}
+
+// cachedToken is the token of one token URL
+type cachedToken struct {
+	token   string
+	expiry  time.Time  // zero if the token has no known expiry
+	pending *tokenCall // the running token request, if any
+}
+
+// tokenCall is a token request shared by concurrent callers
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// NewClientCredentials returns a provider using the given credentials.
+// It is used with WithKeyProvider.
+func NewClientCredentials(clientID, clientSecret string) *ClientCredentials {
+	return &ClientCredentials{clientID: clientID, clientSecret: clientSecret}
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"` // in seconds
+}
+
+// Key returns the cached access token, requesting a new one if needed.
+// Outside of a session, the token is requested to TokenURL, or OAUTH2_TOKEN_RESOURCE.
+func (c *ClientCredentials) Key() (string, error) {
+	return c.sessionKey(nil, "")
+}
+
+// Refresh requests a new access token, unless the token
+// `rejected` was already replaced.
+func (c *ClientCredentials) Refresh(rejected string) error {
+	return c.sessionRefresh(nil, "", rejected)
+}
+
+func (c *ClientCredentials) sessionKey(client *http.Client, baseUrl string) (string, error) {
+	tokenURL, client := c.target(client, baseUrl)
+	c.mu.Lock()
+	cached := c.cached(tokenURL)
+	token, valid := cached.token, cached.token != "" && (cached.expiry.IsZero() || time.Now().Before(cached.expiry))
+	c.mu.Unlock()
+	if valid {
+		return token, nil
+	}
+	return c.fetch(tokenURL, client)
+}
+
+func (c *ClientCredentials) sessionRefresh(client *http.Client, baseUrl string, rejected string) error {
+	tokenURL, client := c.target(client, baseUrl)
+	c.mu.Lock()
+	cached := c.cached(tokenURL)
+	renewed := cached.token != "" && cached.token != rejected
+	c.mu.Unlock()
+	if renewed {
+		return nil
+	}
+	_, err := c.fetch(tokenURL, client)
+	return err
+}
+
+// target returns the token URL and the client used by a session
+// with `client` and `baseUrl`, which may be empty
+func (c *ClientCredentials) target(client *http.Client, baseUrl string) (string, *http.Client) {
+	tokenURL := c.TokenURL
+	if tokenURL == "" {
+		tokenURL = OAUTH2_TOKEN_RESOURCE
+		if baseUrl != "" {
+			tokenURL = baseUrl + strings.TrimPrefix(OAUTH2_TOKEN_RESOURCE, API_BASE_URL)
+		}
+	}
+	if c.Client != nil {
+		client = c.Client
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return tokenURL, client
+}
+
+// cached must be called with the lock held
+func (c *ClientCredentials) cached(tokenURL string) *cachedToken {
+	if c.tokens == nil {
+		c.tokens = make(map[string]*cachedToken)
+	}
+	cached := c.tokens[tokenURL]
+	if cached == nil {
+		cached = new(cachedToken)
+		c.tokens[tokenURL] = cached
+	}
+	return cached
+}
+
+// fetch requests a new token, or waits for the running request.
+// The lock is not held during the request.
+func (c *ClientCredentials) fetch(tokenURL string, client *http.Client) (string, error) {
+	c.mu.Lock()
+	cached := c.cached(tokenURL)
+	if call := cached.pending; call != nil {
+		c.mu.Unlock()
+		<-call.done
+		return call.token, call.err
+	}
+	call := &tokenCall{done: make(chan struct{})}
+	cached.pending = call
+	c.mu.Unlock()
+
+	var expiry time.Time
+	call.token, expiry, call.err = c.request(tokenURL, client)
+
+	c.mu.Lock()
+	if call.err == nil {
+		cached.token, cached.expiry = call.token, expiry
+	}
+	cached.pending = nil
+	c.mu.Unlock()
+	close(call.done)
+	return call.token, call.err
+}
+
+// request performs the token request
+func (c *ClientCredentials) request(tokenURL string, client *http.Client) (string, time.Time, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("requesting access token: %s", err)
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("requesting access token: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, NewHttpError(resp.StatusCode, string(content))
+	}
+
+	var token tokenResponse
+	if err = json.Unmarshal(content, &token); err != nil {
+		return "", time.Time{}, unexpectedAPIResponseErr(err)
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, errors.New("missing access token in response")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return "", time.Time{}, fmt.Errorf("unsupported token type %s", token.TokenType)
+	}
+	return token.AccessToken, tokenExpiry(start, token.ExpiresIn), nil
+}
+
+// tokenExpiry returns the renewal date of a token valid for `expiresIn` seconds
+// from `start`: the margin is reduced for short-lived tokens, so that they are
+// still used for half their lifetime. Without expiry, the token is kept
+// until it is rejected.
+func tokenExpiry(start time.Time, expiresIn int64) time.Time {
+	if expiresIn <= 0 {
+		return time.Time{}
+	}
+	lifetime := time.Duration(expiresIn) * time.Second
+	margin := tokenExpiryMargin
+	if margin > lifetime/2 {
+		margin = lifetime / 2
+	}
+	return start.Add(lifetime - margin)
+}
@@ -0,0 +1,154 @@
+package payplug
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientCredentials(t *testing.T) {
+	var tokens, revoked int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth2/token" {
+			id, secret, _ := r.BasicAuth()
+			if id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			n := atomic.AddInt32(&tokens, 1)
+			json.NewEncoder(w).Encode(tokenResponse{AccessToken: fmt.Sprintf("token_%d", n), TokenType: "bearer", ExpiresIn: 3600})
+			return
+		}
+		current := fmt.Sprintf("token_%d", atomic.LoadInt32(&tokens))
+		if r.Header.Get("Authorization") != "Bearer "+current || atomic.LoadInt32(&revoked) == 1 {
+			atomic.StoreInt32(&revoked, 0)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(Payment{Id: "pay_1"})
+	}))
+	defer api.Close()
+
+	creds := NewClientCredentials("client", "secret")
+	creds.TokenURL = api.URL + "/oauth2/token"
+	s := NewSession("", WithBaseUrl(api.URL), WithKeyProvider(creds))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.GetPayment("pay_1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if tokens != 1 {
+		t.Fatalf("expected one token request, got %d", tokens)
+	}
+
+	// a revoked token is renewed and the request retried
+	atomic.StoreInt32(&revoked, 1)
+	if _, err := s.GetPayment("pay_1"); err != nil {
+		t.Fatal(err)
+	}
+	if tokens != 2 {
+		t.Fatalf("expected a new token, got %d requests", tokens)
+	}
+
+	bad := NewClientCredentials("client", "invalid")
+	bad.TokenURL = creds.TokenURL
+	if _, err := bad.Key(); err == nil {
+		t.Fatal("expected error for invalid credentials")
+	}
+}
+
+type countingTransport struct{ n int32 }
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.n, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestClientCredentialsRefresh(t *testing.T) {
+	var tokens int32
+	expiresIn := int64(3600)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&tokens, 1)
+		json.NewEncoder(w).Encode(tokenResponse{AccessToken: fmt.Sprintf("token_%d", n), ExpiresIn: expiresIn})
+	}))
+	defer api.Close()
+
+	creds := NewClientCredentials("client", "secret")
+	creds.TokenURL = api.URL
+	if _, err := creds.Key(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a token already replaced is not refreshed again
+	if err := creds.Refresh("token_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := creds.Refresh("token_1"); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := creds.Key(); key != "token_2" || tokens != 2 {
+		t.Fatalf("expected a single refresh, got %s after %d requests", key, tokens)
+	}
+
+	// short-lived tokens are still cached
+	expiresIn = 20
+	creds = NewClientCredentials("client", "secret")
+	creds.TokenURL = api.URL
+	for range [3]int{} {
+		if _, err := creds.Key(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tokens != 3 {
+		t.Fatalf("expected a cached token, got %d requests", tokens)
+	}
+}
+
+// TestClientCredentialsSessions checks that a provider shared by sessions
+// requests the tokens with the client and the base URL of each session.
+func TestClientCredentialsSessions(t *testing.T) {
+	newAPI := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/oauth2/token" {
+				json.NewEncoder(w).Encode(tokenResponse{AccessToken: name, ExpiresIn: 3600})
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer "+name {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(Payment{Id: "pay_1"})
+		}))
+	}
+	api1, api2 := newAPI("token_1"), newAPI("token_2")
+	defer api1.Close()
+	defer api2.Close()
+
+	creds := NewClientCredentials("client", "secret")
+	transport1, transport2 := new(countingTransport), new(countingTransport)
+	s1 := NewSession("", WithBaseUrl(api1.URL), WithTransport(transport1), WithKeyProvider(creds))
+	s2 := NewSession("", WithBaseUrl(api2.URL), WithTransport(transport2), WithKeyProvider(creds))
+	for _, s := range []Session{s1, s2, s1, s2} {
+		if _, err := s.GetPayment("pay_1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// one token request, then two payment requests
+	if transport1.n != 3 || transport2.n != 3 {
+		t.Fatalf("expected each session transport to be used, got %d and %d requests", transport1.n, transport2.n)
+	}
+	if creds.TokenURL != "" || creds.Client != nil {
+		t.Fatal("the provider should not be modified")
+	}
+}
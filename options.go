@@ -0,0 +1,220 @@
+package payplug
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the timeout of the HTTP client built by NewSession,
+// unless WithTimeout or WithHTTPClient is used.
+const DefaultTimeout = 30 * time.Second
+
+// Logger receives a line per request (method, URL, status and duration)
+// and per retry. The secret key is never logged.
+// It is implemented by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// RetryPolicy configures the retries of failed requests.
+// Network errors, 429 and 5XX responses are retried; the other
+// errors (invalid options or secret key, other responses) are not.
+// The Retry-After header of 429 and 503 responses is honored,
+// up to one minute.
+type RetryPolicy struct {
+	MaxRetries int           // 0 disables retries
+	Backoff    time.Duration // Delay before the first retry (at least 100ms), doubled on each retry up to one minute
+	// By default, only GET, DELETE and PATCH requests are retried, since
+	// retrying a creation may create duplicates (see CreatePaymentIdempotent).
+	RetryWrites bool
+}
+
+func (r RetryPolicy) shouldRetry(method string, err error, attempt int) bool {
+	if err == nil || attempt >= r.MaxRetries {
+		return false
+	}
+	if method == http.MethodPost && !r.RetryWrites {
+		return false
+	}
+	switch err := err.(type) {
+	case ClientError:
+		return err.transport
+	case HttpError:
+		return err.code == http.StatusTooManyRequests || 500 <= err.code
+	}
+	return false
+}
+
+const (
+	// minRetryDelay avoids retrying in a tight loop
+	minRetryDelay = 100 * time.Millisecond
+	// maxRetryDelay caps the exponential backoff and the Retry-After
+	// delays, unless RetryPolicy.Backoff is already longer
+	maxRetryDelay = time.Minute
+)
+
+// delay returns the delay before retrying after the failed `attempt`,
+// which returned `err`
+func (r RetryPolicy) delay(attempt int, err error) time.Duration {
+	d := r.Backoff
+	if d < minRetryDelay {
+		d = minRetryDelay
+	}
+	for i := 0; i < attempt && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay && r.Backoff <= maxRetryDelay {
+		d = maxRetryDelay
+	}
+	if h, ok := err.(HttpError); ok && h.retryAfter > d {
+		d = h.retryAfter
+		if d > maxRetryDelay {
+			d = maxRetryDelay
+		}
+	}
+	return d
+}
+
+// parseRetryAfter returns the delay requested by the Retry-After
+// header `value`, in seconds or as an HTTP date, or 0
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(value)
+	if err != nil || date.Before(now) {
+		return 0
+	}
+	return date.Sub(now)
+}
+
+// config gathers the settings used to build the HTTP client of a Session.
+type config struct {
+	session   *Session
+	client    *http.Client
+	transport http.RoundTripper
+	timeout   time.Duration
+	proxy     func(*http.Request) (*url.URL, error)
+	tls       *tls.Config
+	pinning   *Pinning
+	caBundle  *CABundle
+}
+
+// Option configures a Session built by NewSession.
+type Option func(*config)
+
+// WithHTTPClient uses `client` as is: the transport, timeout, proxy
+// and TLS options are then ignored. Only pinning (see WithPinning) is added
+// to a copy of the client.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) { c.client = client }
+}
+
+// WithTransport uses `transport` instead of a clone of http.DefaultTransport.
+// The proxy and TLS options only apply if it is an *http.Transport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *config) { c.transport = transport }
+}
+
+// WithTimeout sets the timeout of each request, including
+// reading the response. Zero means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) { c.timeout = timeout }
+}
+
+// WithProxy sets the proxy function of the transport.
+// By default, the proxy is read from the environment (see http.ProxyFromEnvironment).
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(c *config) { c.proxy = proxy }
+}
+
+// WithUserAgentSuffix appends `suffix` to the User-Agent header,
+// for instance "my-shop/2.1".
+func WithUserAgentSuffix(suffix string) Option {
+	return func(c *config) { c.session.userAgentSuffix = suffix }
+}
+
+// WithApiVersion is the same as Session.SetApiVersion.
+func WithApiVersion(version ApiVersion) Option {
+	return func(c *config) { c.session.SetApiVersion(string(version)) }
+}
+
+// WithBaseUrl is the same as Session.SetBaseUrl.
+func WithBaseUrl(url string) Option {
+	return func(c *config) { c.session.SetBaseUrl(url) }
+}
+
+// WithRetryPolicy enables retries of failed requests.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *config) { c.session.retry = policy }
+}
+
+// WithLogger logs the requests to `logger`.
+func WithLogger(logger Logger) Option {
+	return func(c *config) { c.session.logger = logger }
+}
+
+// tlsConfig returns the TLS configuration to modify, creating it if needed.
+func (c *config) tlsConfig() *tls.Config {
+	if c.tls == nil {
+		c.tls = new(tls.Config)
+	}
+	return c.tls
+}
+
+// httpClient builds the client described by `c`.
+func (c *config) httpClient() (*http.Client, error) {
+	if c.client != nil {
+		if c.pinning == nil {
+			return c.client, nil
+		}
+		client := *c.client
+		transport := client.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		transport, err := c.secure(transport)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+		return &client, nil
+	}
+	transport := c.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if t, ok := transport.(*http.Transport); ok && (transport == http.DefaultTransport || c.proxy != nil || c.tls != nil) {
+		t = t.Clone() // never modify a shared transport
+		if c.proxy != nil {
+			t.Proxy = c.proxy
+		}
+		if c.tls != nil {
+			t.TLSClientConfig = c.tls
+		}
+		transport = t
+	}
+	transport, err := c.secure(transport)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport, Timeout: c.timeout}, nil
+}
+
+func (s Session) userAgent() string {
+	ua := "Payplug-Go/" + clientVersion + " (Go/" + goVersion + ")"
+	if s.userAgentSuffix != "" {
+		ua += " " + strings.TrimSpace(s.userAgentSuffix)
+	}
+	return ua
+}
@@ -0,0 +1,142 @@
+package payplug
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptions(t *testing.T) {
+	s := NewSession("sk_test")
+	if s.client == http.DefaultClient || s.client.Timeout != DefaultTimeout {
+		t.Fatalf("unexpected default client %v", s.client)
+	}
+	if tr, ok := s.client.Transport.(*http.Transport); !ok || tr == http.DefaultTransport || tr.Proxy == nil {
+		t.Fatalf("expected a clone of the default transport, got %v", s.client.Transport)
+	}
+
+	client := &http.Client{}
+	if s = NewSession("sk_test", WithHTTPClient(client)); s.client != client {
+		t.Fatal("expected the given client")
+	}
+
+	s = NewSession("sk_test", WithTimeout(time.Second), WithApiVersion("2019-08-06"), WithUserAgentSuffix("shop/1.0"))
+	if s.client.Timeout != time.Second || s.apiVersion != "2019-08-06" || !strings.HasSuffix(s.userAgent(), " shop/1.0") {
+		t.Fatalf("unexpected session %+v", s)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var calls int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			http.Error(w, "{}", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(Payment{Id: "pay_1"})
+	}))
+	defer api.Close()
+
+	var logs bytes.Buffer
+	s := NewSession("sk_test", WithBaseUrl(api.URL), WithLogger(log.New(&logs, "", 0)),
+		WithRetryPolicy(RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}))
+	p, err := s.GetPayment("pay_1")
+	if err != nil || p.Id != "pay_1" || calls != 3 {
+		t.Fatalf("unexpected %v (%v) after %d calls", p, err, calls)
+	}
+	if strings.Count(logs.String(), "retrying") != 2 || strings.Contains(logs.String(), "sk_test") {
+		t.Fatalf("unexpected logs %s", logs.String())
+	}
+
+	// creations are not retried by default
+	calls = 0
+	if _, err = s.CreatePayment(Payment{Amount: 1000, Currency: Eur}); err == nil || calls != 1 {
+		t.Fatalf("expected a single failed call, got %d (%v)", calls, err)
+	}
+
+	// the Retry-After header of the response is kept for the retry
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		http.Error(w, "{}", http.StatusTooManyRequests)
+	}))
+	defer api.Close()
+	s = NewSession("sk_test", WithBaseUrl(api.URL))
+	if _, err = s.GetPayment("pay_1"); err == nil || err.(HttpError).retryAfter != 7*time.Second {
+		t.Fatalf("expected Retry-After in error, got %#v", err)
+	}
+}
+
+func TestRetryPolicyErrors(t *testing.T) {
+	r := RetryPolicy{MaxRetries: 3, Backoff: time.Second}
+	for _, test := range []struct {
+		err   error
+		retry bool
+	}{
+		{ClientError{err: errors.New("connection reset"), transport: true}, true},
+		{ClientError{err: errors.New("invalid key file")}, false},
+		{NewHttpError(http.StatusTooManyRequests, ""), true},
+		{NewHttpError(http.StatusBadGateway, ""), true},
+		{NewHttpError(http.StatusNotFound, ""), false},
+		{ValidationError{Field: "amount"}, false},
+	} {
+		if got := r.shouldRetry(http.MethodGet, test.err, 0); got != test.retry {
+			t.Fatalf("%v: expected retry %v", test.err, test.retry)
+		}
+	}
+
+	for attempt, exp := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if got := r.delay(attempt, nil); got != exp {
+			t.Fatalf("attempt %d: expected %s, got %s", attempt, exp, got)
+		}
+	}
+	if got := r.delay(100, nil); got != maxRetryDelay {
+		t.Fatalf("expected capped delay, got %s", got)
+	}
+	if got := (RetryPolicy{Backoff: time.Hour}).delay(3, nil); got != time.Hour {
+		t.Fatalf("expected the backoff, got %s", got)
+	}
+	if got := (RetryPolicy{}).delay(0, nil); got != minRetryDelay {
+		t.Fatalf("expected the minimum delay, got %s", got)
+	}
+
+	// Retry-After is honored, up to maxRetryDelay
+	for _, test := range []struct {
+		retryAfter time.Duration
+		exp        time.Duration
+	}{
+		{10 * time.Second, 10 * time.Second},
+		{time.Hour, maxRetryDelay},
+		{time.Millisecond, time.Second}, // shorter than the backoff
+	} {
+		err := HttpError{code: http.StatusTooManyRequests, retryAfter: test.retryAfter}
+		if got := r.delay(0, err); got != test.exp {
+			t.Fatalf("Retry-After %s: expected %s, got %s", test.retryAfter, test.exp, got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		value string
+		exp   time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{"Wed, 01 Jan 2020 12:00:30 GMT", 30 * time.Second},
+		{"Wed, 01 Jan 2020 11:00:00 GMT", 0}, // past
+		{"soon", 0},
+	} {
+		if got := parseRetryAfter(test.value, now); got != test.exp {
+			t.Errorf("%q: expected %s, got %s", test.value, test.exp, got)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package payplug
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// MethodType identifies a payment method.
+type MethodType string
+
+const (
+	MethodCard            MethodType = ""           // Default: card payment on the hosted page. See also SavedCard.
+	MethodApplePay        MethodType = "apple_pay"  // Requires PaymentContext.ApplePay
+	MethodBancontact      MethodType = "bancontact" // Belgium
+	MethodAmericanExpress MethodType = "american_express"
+	MethodSatispay        MethodType = "satispay"
+	MethodIdeal           MethodType = "ideal"  // Netherlands
+	MethodMyBank          MethodType = "mybank" // Italy
+	MethodOneyX3          MethodType = "oney_x3_with_fees"
+	MethodOneyX4          MethodType = "oney_x4_with_fees"
+	MethodOneyX3NoFees    MethodType = "oney_x3_without_fees"
+	MethodOneyX4NoFees    MethodType = "oney_x4_without_fees"
+)
+
+// IsOney returns true for the Oney split payments.
+func (m MethodType) IsOney() bool {
+	switch m {
+	case MethodOneyX3, MethodOneyX4, MethodOneyX3NoFees, MethodOneyX4NoFees:
+		return true
+	}
+	return false
+}
+
+// eurOnly returns true if the method only supports payments in euros.
+func (m MethodType) eurOnly() bool {
+	switch m {
+	case MethodBancontact, MethodSatispay, MethodIdeal, MethodMyBank:
+		return true
+	}
+	return m.IsOney()
+}
+
+// PaymentMethod selects the payment method when creating a payment,
+// and describes the method used when decoding one.
+// It is sent as a plain string (its type) on creation, and decoded
+// from either a string or an object.
+type PaymentMethod struct {
+	Type      MethodType `json:"type,omitempty"`       // The type of payment method
+	IsPending bool       `json:"is_pending,omitempty"` // Oney only: whether the payment is in a pending state for Oney. If this is true, it means that the payer has successfully filled out Oney’s payment form, but Oney is still analyzing the payer’s file. In this case, the payment is neither authorized nor paid yet, but in a pending state.
+}
+
+func (pm PaymentMethod) MarshalJSON() ([]byte, error) {
+	if pm.Type == MethodCard {
+		return json.Marshal(nil)
+	}
+	if !pm.IsPending {
+		return json.Marshal(pm.Type)
+	}
+	type plain PaymentMethod // avoid recursion
+	return json.Marshal(plain(pm))
+}
+
+func (pm *PaymentMethod) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case bytes.Equal(b, []byte("null")):
+		*pm = PaymentMethod{}
+		return nil
+	case len(b) != 0 && b[0] == '"':
+		*pm = PaymentMethod{}
+		return json.Unmarshal(b, &pm.Type)
+	}
+	type plain PaymentMethod // avoid recursion
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	*pm = PaymentMethod(p)
+	return nil
+}
+
+// ApplePayContext is the data required to create an Apple Pay payment.
+type ApplePayContext struct {
+	DomainName      string `json:"domain_name,omitempty"`      // The domain name of the merchant website, registered with Apple.
+	ApplicationData string `json:"application_data,omitempty"` // OPTIONAL Base64 encoded data passed to Apple Pay.
+}
+
+// PaymentContext gathers the additional data needed by some payment methods.
+type PaymentContext struct {
+	ApplePay *ApplePayContext `json:"apple_pay,omitempty"`
+}
+
+// SetAllowedMethods restricts the payment methods accepted by CreatePayment.
+// Use MethodCard to allow card payments. With no arguments, all methods are allowed.
+func (s *Session) SetAllowedMethods(methods ...MethodType) {
+	if len(methods) == 0 {
+		s.allowedMethods = nil
+		return
+	}
+	s.allowedMethods = make(map[MethodType]bool, len(methods))
+	for _, m := range methods {
+		s.allowedMethods[m] = true
+	}
+}
+
+// validateMethod checks that the payment method of `p` is allowed,
+// and that `p` has the data it requires.
+func (s Session) validateMethod(p Payment) error {
+	m := p.PaymentMethod.Type
+	if m.IsSavedCard() {
+		m = MethodCard
+	}
+	if s.allowedMethods != nil && !s.allowedMethods[m] {
+		return ValidationError{Field: "payment_method", Reason: fmt.Sprintf("method %q is not allowed", m)}
+	}
+	if m.eurOnly() && p.Currency != Eur {
+		return ValidationError{Field: "payment_method", Reason: fmt.Sprintf("method %q only supports %s", m, Eur)}
+	}
+	if m == MethodApplePay && (p.PaymentContext == nil || p.PaymentContext.ApplePay == nil || p.PaymentContext.ApplePay.DomainName == "") {
+		return ValidationError{Field: "payment_context", Reason: "Apple Pay requires a domain name"}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package payplug
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPaymentMethodJSON(t *testing.T) {
+	for _, test := range []struct {
+		pm  PaymentMethod
+		exp string
+	}{
+		{PaymentMethod{}, `null`},
+		{PaymentMethod{Type: MethodBancontact}, `"bancontact"`},
+		{PaymentMethod{Type: MethodOneyX3, IsPending: true}, `{"type":"oney_x3_with_fees","is_pending":true}`},
+	} {
+		b, err := json.Marshal(test.pm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != test.exp {
+			t.Fatalf("expected %s, got %s", test.exp, b)
+		}
+		var back PaymentMethod
+		if err = json.Unmarshal(b, &back); err != nil {
+			t.Fatal(err)
+		}
+		if back != test.pm {
+			t.Fatalf("expected %v, got %v", test.pm, back)
+		}
+	}
+
+	var p Payment
+	if err := json.Unmarshal([]byte(`{"payment_method": {"type": "ideal"}}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.PaymentMethod.Type != MethodIdeal {
+		t.Fatalf("unexpected method %v", p.PaymentMethod)
+	}
+}
+
+func TestValidateMethod(t *testing.T) {
+	s := NewSession("sk_test")
+	if err := s.validateMethod(Payment{Currency: Usd, PaymentMethod: PaymentMethod{Type: MethodIdeal}}); err == nil {
+		t.Fatal("expected error for iDEAL in USD")
+	}
+	if err := s.validateMethod(Payment{Currency: Eur, PaymentMethod: PaymentMethod{Type: MethodApplePay}}); err == nil {
+		t.Fatal("expected error for missing Apple Pay context")
+	}
+	s.SetAllowedMethods(MethodCard, MethodBancontact)
+	if err := s.validateMethod(Payment{Currency: Eur, PaymentMethod: PaymentMethod{Type: MethodBancontact}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.validateMethod(Payment{Currency: Eur, PaymentMethod: PaymentMethod{Type: MethodMyBank}}); err == nil {
+		t.Fatal("expected error for restricted method")
+	}
+}
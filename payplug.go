@@ -3,34 +3,64 @@ package payplug
 
 import (
 	"bytes"
-	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"reflect"
 	"runtime"
+	"strings"
+	"time"
 )
 
 const clientVersion = "1.0.0"
 
+var goVersion = runtime.Version()
+
 // Session enables to create requests
 // to Payplug server.
+//
+// A Session is safe for concurrent use by multiple goroutines,
+// provided its Set* methods are not called while requests are running.
 type Session struct {
-	secretKey  string
-	apiVersion string
+	keys       KeyProvider
+	apiVersion ApiVersion
+	versionErr error  // returned by the requests, if apiVersion is invalid
+	baseUrl    string // replaces API_BASE_URL when not empty
+
+	allowedMethods map[MethodType]bool // nil means no restriction
+
+	idempotency           IdempotencyStore
+	sendIdempotencyHeader bool
 
-	client *http.Client
+	userAgentSuffix string
+	retry           RetryPolicy
+	logger          Logger
+	onWarning       func(Warning)
+	onDrift         func(Drift) // strict decoding mode
+
+	client    *http.Client
+	configErr error // returned by the requests, if the options are invalid
 }
 
-// NewSession returns a controller, using the API secret key.
-func NewSession(secretKey string) Session {
-	return Session{secretKey: secretKey, client: http.DefaultClient}
+// NewSession returns a controller, using the API secret key
+// (see WithKeyProvider to rotate keys without rebuilding the session).
+// By default, requests time out after DefaultTimeout, and the proxy
+// is read from the environment. See the With* functions for the available options.
+func NewSession(secretKey string, opts ...Option) Session {
+	s := Session{keys: StaticKey(secretKey)}
+	cfg := config{session: &s, timeout: DefaultTimeout}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	s.client, s.configErr = cfg.httpClient()
+	return s
 }
 
 // NewSessionCert use `cert` content as a CA bundle
-func NewSessionCert(token string, cert io.Reader) (Session, error) {
+func NewSessionCert(token string, cert io.Reader, opts ...Option) (Session, error) {
 	caCert, err := ioutil.ReadAll(cert)
 	if err != nil {
 		return Session{}, fmt.Errorf("missing CA: %s", err)
@@ -38,25 +68,72 @@ func NewSessionCert(token string, cert io.Reader) (Session, error) {
 	caCertPool := x509.NewCertPool()
 	caCertPool.AppendCertsFromPEM(caCert)
 
-	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: caCertPool}}}
-
-	return Session{secretKey: token, client: client}, nil
+	withCA := func(c *config) { c.tlsConfig().RootCAs = caCertPool }
+	return NewSession(token, append([]Option{withCA}, opts...)...), nil
 }
 
-// SetApiVersion set the desired `version`, as an ISO-8601 date
-func (s *Session) SetApiVersion(version string) {
-	s.apiVersion = version
+// SetBaseUrl redirects the requests targeting API_BASE_URL to `url`
+// (for instance "http://localhost:8080"), which is useful to run against
+// a local simulator.
+func (s *Session) SetBaseUrl(url string) {
+	s.baseUrl = strings.TrimSuffix(url, "/")
 }
 
 // Perform an HTTP request, by marshalling `body` as JSON, and unmarshal the response in `out`, which must be
-// a pointer type.
+// a pointer type, or nil if the response is ignored.
 // The status code is also checked, meaning that if `err` is nil, then `status` is valid (in the 2XX range).
 func (s Session) Request(method, url string, body interface{}, out interface{}) (status int, err error) {
+	return s.request(method, url, body, out, nil)
+}
+
+// request is the same as Request, adding the optional `header` to the request.
+// Failed requests are retried according to the retry policy of the session.
+func (s Session) request(method, url string, body interface{}, out interface{}, header http.Header) (status int, err error) {
 	b, err := json.Marshal(body)
 	if err != nil {
 		return 0, ClientError{err: err}
 	}
 
+	if s.baseUrl != "" && strings.HasPrefix(url, API_BASE_URL) {
+		url = s.baseUrl + strings.TrimPrefix(url, API_BASE_URL)
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		key, errKey := s.secretKey()
+		if errKey != nil {
+			return 0, errKey
+		}
+		start := time.Now()
+		status, err = s.do(method, url, key, b, out, header)
+		if s.logger != nil {
+			s.logger.Printf("payplug: %s %s: %d (%s)", method, url, status, time.Since(start).Round(time.Millisecond))
+		}
+		if status == http.StatusUnauthorized && !refreshed && s.refreshableKey() {
+			// the key may have been rotated: refresh it and retry once
+			refreshed = true
+			if errRefresh := s.refreshKey(key); errRefresh != nil {
+				return status, ClientError{err: fmt.Errorf("refreshing secret key: %s", errRefresh)}
+			}
+			attempt--
+			continue
+		}
+		if !s.retry.shouldRetry(method, err, attempt) {
+			return status, err
+		}
+		delay := s.retry.delay(attempt, err)
+		if s.logger != nil {
+			s.logger.Printf("payplug: retrying in %s after error: %s", delay, err)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// do performs one HTTP request with the secret `key`, `b` being the JSON body.
+func (s Session) do(method, url, key string, b []byte, out interface{}, header http.Header) (status int, err error) {
+	if s.configErr != nil {
+		return 0, ClientError{err: s.configErr}
+	}
 	req, err := http.NewRequest(method, url, bytes.NewReader(b))
 	if err != nil {
 		return 0, ClientError{err: err}
@@ -64,42 +141,241 @@ func (s Session) Request(method, url string, body interface{}, out interface{})
 
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
-	userAgent := fmt.Sprintf("Payplug-Go/%s (Go/%s)", clientVersion, runtime.Version())
-	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("User-Agent", s.userAgent())
 
-	if s.secretKey == "" {
-		return 0, SecretKeyNotSet
-	}
-	req.Header.Set("Authorization", "Bearer "+s.secretKey)
+	req.Header.Set("Authorization", "Bearer "+key)
 
+	if s.versionErr != nil {
+		return 0, s.versionErr
+	}
 	if s.apiVersion != "" {
-		req.Header.Set("PayPlug-Version", s.apiVersion)
+		req.Header.Set(versionHeader, string(s.apiVersion))
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
 	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return 0, ClientError{err: err}
+		return 0, ClientError{err: err, transport: true}
 	}
 	defer resp.Body.Close()
 
 	content, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return resp.StatusCode, ClientError{err: err}
+		return resp.StatusCode, ClientError{err: err, transport: true}
 	}
 
+	s.checkHeaders(url, resp)
+
 	if !(200 <= resp.StatusCode && resp.StatusCode < 300) {
-		return resp.StatusCode, HttpError{code: resp.StatusCode, err: string(content)}
+		httpErr := HttpError{code: resp.StatusCode, err: string(content)}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			httpErr.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return resp.StatusCode, httpErr
+	}
+
+	if out == nil || len(content) == 0 { // for instance 204 No Content
+		return resp.StatusCode, nil
 	}
 
 	if err := json.Unmarshal(content, out); err != nil {
 		return resp.StatusCode, unexpectedAPIResponseErr(err)
 	}
+	if s.onDrift != nil {
+		checkDrift(content, reflect.TypeOf(out), func(d Drift) {
+			d.URL = url
+			s.onDrift(d)
+		})
+	}
 	return resp.StatusCode, nil
 }
 
 // CreatePayment is a shortcut to add `payment`.
+// Its currency, amount, payment method, SCA fields and metadata are checked before sending the request.
 func (s Session) CreatePayment(payment Payment) (Payment, error) {
+	return s.createPayment(payment, nil)
+}
+
+func (s Session) createPayment(payment Payment, header http.Header) (Payment, error) {
+	if err := s.validatePayment(payment); err != nil {
+		return Payment{}, err
+	}
+	payment.Raw = nil // only send the modelled fields
 	var out Payment
-	_, err := s.Request(http.MethodPost, PAYMENT_RESOURCE, payment, &out)
+	_, err := s.request(http.MethodPost, PAYMENT_RESOURCE, payment, &out, header)
+	return out, err
+}
+
+// validatePayment performs the checks of CreatePayment
+func (s Session) validatePayment(payment Payment) error {
+	if err := payment.Currency.ValidateAmount(payment.Amount); err != nil {
+		return err
+	}
+	if err := s.validateMethod(payment); err != nil {
+		return err
+	}
+	if err := validateSca(payment); err != nil {
+		return err
+	}
+	return payment.Metadata.Validate()
+}
+
+// GetPayment retrieves the payment with the given `id`.
+func (s Session) GetPayment(id string) (Payment, error) {
+	p := Payment{Id: id}
+	var out Payment
+	_, err := s.Request(http.MethodGet, p.urlForConsistent(), nil, &out)
+	return out, err
+}
+
+// ListPayments returns the page `page` (starting at 0) of the payments,
+// with at most `perPage` items. Payments are sorted from the most recent.
+func (s Session) ListPayments(page, perPage int) (PaymentList, error) {
+	url := fmt.Sprintf("%s?page=%d&per_page=%d", PAYMENT_RESOURCE, page, perPage)
+	var out PaymentList
+	_, err := s.Request(http.MethodGet, url, nil, &out)
+	return out, err
+}
+
+// WalkPayments calls `fn` for each payment created between `from` and `to` (inclusive),
+// requesting the pages as needed. It stops at the first error.
+// Since the API sorts the payments from the most recent, pages are
+// requested until a payment older than `from` is found.
+func (s Session) WalkPayments(from, to Timestamp, fn func(Payment) error) error {
+	const perPage = 50 // maximum page size accepted by the API
+	for page := 0; ; page++ {
+		list, err := s.ListPayments(page, perPage)
+		if err != nil {
+			return fmt.Errorf("listing payments (page %d): %s", page, err)
+		}
+		done := !list.HasMore
+		for _, p := range list.Data {
+			if p.CreatedAt < from {
+				done = true
+				continue
+			}
+			if p.CreatedAt > to {
+				continue
+			}
+			if err = fn(p); err != nil {
+				return err
+			}
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// ListRefunds returns the refunds of the payment `paymentId`.
+func (s Session) ListRefunds(paymentId string) (RefundList, error) {
+	var out RefundList
+	_, err := s.Request(http.MethodGet, fmt.Sprintf(REFUND_RESOURCE, paymentId), nil, &out)
+	return out, err
+}
+
+// GetInstallmentPlan retrieves the installment plan with the given `id`.
+func (s Session) GetInstallmentPlan(id string) (InstallmentPlan, error) {
+	i := InstallmentPlan{Id: id}
+	var out InstallmentPlan
+	_, err := s.Request(http.MethodGet, i.urlForConsistent(), nil, &out)
+	return out, err
+}
+
+// AbortPayment aborts the payment with the given `id`,
+// so that it can no longer be paid.
+func (s Session) AbortPayment(id string) (Payment, error) {
+	p := Payment{Id: id}
+	var out Payment
+	_, err := s.Request(http.MethodPatch, p.urlForConsistent(), map[string]bool{"aborted": true}, &out)
+	return out, err
+}
+
+// CreateRefund refunds `refund.Amount` (or the whole remaining amount if zero)
+// of the payment `paymentId`.
+func (s Session) CreateRefund(paymentId string, refund Refund) (Refund, error) {
+	return s.createRefund(paymentId, refund, nil)
+}
+
+func (s Session) createRefund(paymentId string, refund Refund, header http.Header) (Refund, error) {
+	if err := refund.Metadata.Validate(); err != nil {
+		return Refund{}, err
+	}
+	body := Refund{Amount: refund.Amount, Metadata: refund.Metadata}
+	var out Refund
+	_, err := s.request(http.MethodPost, fmt.Sprintf(REFUND_RESOURCE, paymentId), body, &out, header)
+	return out, err
+}
+
+// CreateCustomer is a shortcut to add `customer`.
+func (s Session) CreateCustomer(customer Customer) (Customer, error) {
+	if err := customer.Metadata.Validate(); err != nil {
+		return Customer{}, err
+	}
+	customer.Raw = nil // only send the modelled fields
+	var out Customer
+	_, err := s.Request(http.MethodPost, CUSTOMER_RESOURCE, customer, &out)
+	return out, err
+}
+
+// GetCustomer retrieves the customer with the given `id`.
+func (s Session) GetCustomer(id string) (Customer, error) {
+	var out Customer
+	_, err := s.Request(http.MethodGet, CUSTOMER_RESOURCE+"/"+id, nil, &out)
+	return out, err
+}
+
+// ListCustomers returns the page `page` (starting at 0) of the customers,
+// with at most `perPage` items.
+func (s Session) ListCustomers(page, perPage int) (CustomerList, error) {
+	url := fmt.Sprintf("%s?page=%d&per_page=%d", CUSTOMER_RESOURCE, page, perPage)
+	var out CustomerList
+	_, err := s.Request(http.MethodGet, url, nil, &out)
+	return out, err
+}
+
+// DeleteCustomer deletes the customer with the given `id`, and its cards.
+func (s Session) DeleteCustomer(id string) error {
+	_, err := s.Request(http.MethodDelete, CUSTOMER_RESOURCE+"/"+id, nil, nil)
+	return err
+}
+
+// ListCards returns the cards saved for the customer `customerId`.
+func (s Session) ListCards(customerId string) (CardList, error) {
+	var out CardList
+	_, err := s.Request(http.MethodGet, fmt.Sprintf(CARD_RESOURCE, customerId), nil, &out)
+	return out, err
+}
+
+// GetCard retrieves the card `cardId` of the customer `customerId`.
+func (s Session) GetCard(customerId, cardId string) (Card, error) {
+	var out Card
+	_, err := s.Request(http.MethodGet, fmt.Sprintf(CARD_RESOURCE, customerId)+"/"+cardId, nil, &out)
+	return out, err
+}
+
+// DeleteCard deletes the card `cardId` of the customer `customerId`.
+func (s Session) DeleteCard(customerId, cardId string) error {
+	_, err := s.Request(http.MethodDelete, fmt.Sprintf(CARD_RESOURCE, customerId)+"/"+cardId, nil, nil)
+	return err
+}
+
+// CreateAccountingReport requests the generation of an accounting report.
+// Only `StartDate`, `EndDate` and `NotificationUrl` are used.
+func (s Session) CreateAccountingReport(report AccountingReport) (AccountingReport, error) {
+	body := AccountingReport{StartDate: report.StartDate, EndDate: report.EndDate, NotificationUrl: report.NotificationUrl}
+	var out AccountingReport
+	_, err := s.Request(http.MethodPost, ACCOUNTING_REPORT_RESOURCE, body, &out)
+	return out, err
+}
+
+// GetAccountingReport retrieves the accounting report with the given `id`.
+func (s Session) GetAccountingReport(id string) (AccountingReport, error) {
+	a := AccountingReport{Id: id}
+	var out AccountingReport
+	_, err := s.Request(http.MethodGet, a.urlForConsistent(), nil, &out)
 	return out, err
 }
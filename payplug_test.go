@@ -21,7 +21,7 @@ func TestCA(t *testing.T) {
 
 func TestWBadAuth(t *testing.T) {
 	s := NewSession("invalid token")
-	_, err := s.CreatePayment(Payment{})
+	_, err := s.CreatePayment(Payment{Amount: 1000, Currency: Eur})
 	if asHttpError, ok := err.(HttpError); ok {
 		if asHttpError.code != 401 {
 			t.Fatalf("wrong error code, expected 401, got %d", asHttpError.code)
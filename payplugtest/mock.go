@@ -0,0 +1,275 @@
+// Package payplugtest provides a mock of payplug.Client, so that
+// payment flows may be unit tested without any HTTP request.
+package payplugtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+// Call is a recorded call to the mock.
+type Call struct {
+	Method string        // For instance "GetPayment"
+	Args   []interface{} // The arguments, in order
+}
+
+type response struct {
+	value interface{}
+	err   error
+}
+
+// Mock implements payplug.Client, recording the calls and returning
+// the scripted responses. It is safe for concurrent use.
+//
+// Responses are scripted by method name with On, and consumed in order.
+// The last response of a method is repeated once the others are consumed.
+// Calling a method without scripted response returns an error.
+type Mock struct {
+	mu        sync.Mutex
+	calls     []Call
+	responses map[string][]response
+}
+
+var _ payplug.Client = (*Mock)(nil)
+
+// On queues a response for `method`: `value` must have the type of the
+// first result of the method, or be nil for its zero value (it is ignored for
+// methods returning only an error). Otherwise, the call returns an error.
+// For Request, `value` is converted to the `out` argument through JSON.
+// For WalkPayments, `value` is the []payplug.Payment passed to the callback.
+// `err` is typically a payplug.HttpError or payplug.ClientError (see
+// payplug.NewHttpError and payplug.NewClientError).
+func (m *Mock) On(method string, value interface{}, err error) *Mock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.responses == nil {
+		m.responses = make(map[string][]response)
+	}
+	m.responses[method] = append(m.responses[method], response{value, err})
+	return m
+}
+
+// Calls returns the calls made so far.
+func (m *Mock) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallsTo returns the calls made so far to `method`.
+func (m *Mock) CallsTo(method string) []Call {
+	var out []Call
+	for _, c := range m.Calls() {
+		if c.Method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Reset forgets the calls and the scripted responses.
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls, m.responses = nil, nil
+}
+
+func (m *Mock) call(method string, args ...interface{}) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+	queue := m.responses[method]
+	if len(queue) == 0 {
+		return nil, fmt.Errorf("payplugtest: no response scripted for %s", method)
+	}
+	r := queue[0]
+	if len(queue) > 1 {
+		m.responses[method] = queue[1:]
+	}
+	return r.value, r.err
+}
+
+// typed converts the scripted value `v` of `method` to its result type.
+// A nil value stands for the zero value.
+func typed[T any](method string, v interface{}, err error) (T, error) {
+	var out T
+	if v == nil {
+		return out, err
+	}
+	out, ok := v.(T)
+	if !ok {
+		return out, fmt.Errorf("payplugtest: invalid value scripted for %s: expected %T, got %T", method, out, v)
+	}
+	return out, err
+}
+
+func (m *Mock) Request(method, url string, body interface{}, out interface{}) (int, error) {
+	v, err := m.call("Request", method, url, body, out)
+	if err != nil {
+		if h, ok := err.(payplug.HttpError); ok {
+			return h.StatusCode(), err
+		}
+		return 0, err
+	}
+	if out != nil && v != nil {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return 0, err
+		}
+		if err = json.Unmarshal(b, out); err != nil {
+			return 0, err
+		}
+	}
+	return 200, nil
+}
+
+func (m *Mock) WalkPayments(from, to payplug.Timestamp, fn func(payplug.Payment) error) error {
+	v, err := m.call("WalkPayments", from, to, fn)
+	if err != nil {
+		return err
+	}
+	payments, err := typed[[]payplug.Payment]("WalkPayments", v, nil)
+	if err != nil {
+		return err
+	}
+	for _, p := range payments {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Mock) CreatePayment(payment payplug.Payment) (payplug.Payment, error) {
+	v, err := m.call("CreatePayment", payment)
+	return typed[payplug.Payment]("CreatePayment", v, err)
+}
+
+func (m *Mock) CreatePaymentIdempotent(key string, payment payplug.Payment) (payplug.Payment, error) {
+	v, err := m.call("CreatePaymentIdempotent", key, payment)
+	return typed[payplug.Payment]("CreatePaymentIdempotent", v, err)
+}
+
+func (m *Mock) GetPayment(id string) (payplug.Payment, error) {
+	v, err := m.call("GetPayment", id)
+	return typed[payplug.Payment]("GetPayment", v, err)
+}
+
+func (m *Mock) ListPayments(page, perPage int) (payplug.PaymentList, error) {
+	v, err := m.call("ListPayments", page, perPage)
+	return typed[payplug.PaymentList]("ListPayments", v, err)
+}
+
+func (m *Mock) AbortPayment(id string) (payplug.Payment, error) {
+	v, err := m.call("AbortPayment", id)
+	return typed[payplug.Payment]("AbortPayment", v, err)
+}
+
+func (m *Mock) CreateRefund(paymentId string, refund payplug.Refund) (payplug.Refund, error) {
+	v, err := m.call("CreateRefund", paymentId, refund)
+	return typed[payplug.Refund]("CreateRefund", v, err)
+}
+
+func (m *Mock) CreateRefundIdempotent(key string, paymentId string, refund payplug.Refund) (payplug.Refund, error) {
+	v, err := m.call("CreateRefundIdempotent", key, paymentId, refund)
+	return typed[payplug.Refund]("CreateRefundIdempotent", v, err)
+}
+
+func (m *Mock) ListRefunds(paymentId string) (payplug.RefundList, error) {
+	v, err := m.call("ListRefunds", paymentId)
+	return typed[payplug.RefundList]("ListRefunds", v, err)
+}
+
+func (m *Mock) ExecuteRefundPlan(plan payplug.RefundPlan, metadata payplug.Metadata) ([]payplug.RefundOutcome, error) {
+	v, err := m.call("ExecuteRefundPlan", plan, metadata)
+	return typed[[]payplug.RefundOutcome]("ExecuteRefundPlan", v, err)
+}
+
+func (m *Mock) GetPayments(ids []string, opts payplug.BatchOptions) ([]payplug.BatchResult[payplug.Payment], error) {
+	v, err := m.call("GetPayments", ids, opts)
+	return typed[[]payplug.BatchResult[payplug.Payment]]("GetPayments", v, err)
+}
+
+func (m *Mock) AbortPayments(ids []string, opts payplug.BatchOptions) ([]payplug.BatchResult[payplug.Payment], error) {
+	v, err := m.call("AbortPayments", ids, opts)
+	return typed[[]payplug.BatchResult[payplug.Payment]]("AbortPayments", v, err)
+}
+
+func (m *Mock) RefundPayments(plan payplug.RefundPlan, metadata payplug.Metadata, opts payplug.BatchOptions) ([]payplug.BatchResult[payplug.Refund], error) {
+	v, err := m.call("RefundPayments", plan, metadata, opts)
+	return typed[[]payplug.BatchResult[payplug.Refund]]("RefundPayments", v, err)
+}
+
+func (m *Mock) CreateCustomer(customer payplug.Customer) (payplug.Customer, error) {
+	v, err := m.call("CreateCustomer", customer)
+	return typed[payplug.Customer]("CreateCustomer", v, err)
+}
+
+func (m *Mock) GetCustomer(id string) (payplug.Customer, error) {
+	v, err := m.call("GetCustomer", id)
+	return typed[payplug.Customer]("GetCustomer", v, err)
+}
+
+func (m *Mock) ListCustomers(page, perPage int) (payplug.CustomerList, error) {
+	v, err := m.call("ListCustomers", page, perPage)
+	return typed[payplug.CustomerList]("ListCustomers", v, err)
+}
+
+func (m *Mock) DeleteCustomer(id string) error {
+	_, err := m.call("DeleteCustomer", id)
+	return err
+}
+
+func (m *Mock) ListCards(customerId string) (payplug.CardList, error) {
+	v, err := m.call("ListCards", customerId)
+	return typed[payplug.CardList]("ListCards", v, err)
+}
+
+func (m *Mock) GetCard(customerId, cardId string) (payplug.Card, error) {
+	v, err := m.call("GetCard", customerId, cardId)
+	return typed[payplug.Card]("GetCard", v, err)
+}
+
+func (m *Mock) DeleteCard(customerId, cardId string) error {
+	_, err := m.call("DeleteCard", customerId, cardId)
+	return err
+}
+
+func (m *Mock) GetInstallmentPlan(id string) (payplug.InstallmentPlan, error) {
+	v, err := m.call("GetInstallmentPlan", id)
+	return typed[payplug.InstallmentPlan]("GetInstallmentPlan", v, err)
+}
+
+func (m *Mock) CreateAccountingReport(report payplug.AccountingReport) (payplug.AccountingReport, error) {
+	v, err := m.call("CreateAccountingReport", report)
+	return typed[payplug.AccountingReport]("CreateAccountingReport", v, err)
+}
+
+func (m *Mock) GetAccountingReport(id string) (payplug.AccountingReport, error) {
+	v, err := m.call("GetAccountingReport", id)
+	return typed[payplug.AccountingReport]("GetAccountingReport", v, err)
+}
+
+func (m *Mock) HandleNotificationPayment(body io.Reader) (payplug.Payment, error) {
+	v, err := m.call("HandleNotificationPayment", body)
+	return typed[payplug.Payment]("HandleNotificationPayment", v, err)
+}
+
+func (m *Mock) HandleNotificationRefund(body io.Reader) (payplug.Refund, error) {
+	v, err := m.call("HandleNotificationRefund", body)
+	return typed[payplug.Refund]("HandleNotificationRefund", v, err)
+}
+
+func (m *Mock) HandleNotificationAccountingReport(body io.Reader) (payplug.AccountingReport, error) {
+	v, err := m.call("HandleNotificationAccountingReport", body)
+	return typed[payplug.AccountingReport]("HandleNotificationAccountingReport", v, err)
+}
+
+func (m *Mock) HandleNotificationInstallmentPlan(body io.Reader) (payplug.InstallmentPlan, error) {
+	v, err := m.call("HandleNotificationInstallmentPlan", body)
+	return typed[payplug.InstallmentPlan]("HandleNotificationInstallmentPlan", v, err)
+}
@@ -0,0 +1,61 @@
+package payplugtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	payplug "github.com/benoitkugler/payplug-go"
+	"github.com/benoitkugler/payplug-go/reconcile"
+)
+
+func TestMock(t *testing.T) {
+	m := new(Mock)
+	m.On("GetPayment", payplug.Payment{Id: "pay_1", IsPaid: true}, nil).
+		On("GetPayment", nil, payplug.NewHttpError(404, `{"message": "not found"}`))
+
+	p, err := m.GetPayment("pay_1")
+	if err != nil || p.Id != "pay_1" {
+		t.Fatalf("unexpected %v (%v)", p, err)
+	}
+	for range [2]int{} { // the last response is repeated
+		_, err = m.GetPayment("pay_2")
+		if h, ok := err.(payplug.HttpError); !ok || h.StatusCode() != 404 {
+			t.Fatalf("expected 404 HttpError, got %v", err)
+		}
+	}
+	if calls := m.CallsTo("GetPayment"); len(calls) != 3 || calls[1].Args[0] != "pay_2" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+
+	if err = m.DeleteCard("cus_1", "card_1"); err == nil {
+		t.Fatal("expected error for unscripted method")
+	}
+
+	m.On("Request", map[string]string{"id": "re_1"}, nil)
+	var r payplug.Refund
+	if _, err = m.Request("GET", "url", nil, &r); err != nil || r.Id != "re_1" {
+		t.Fatalf("unexpected %v (%v)", r, err)
+	}
+
+	m.On("GetCustomer", payplug.Payment{Id: "pay_1"}, nil) // wrong type
+	if _, err = m.GetCustomer("cus_1"); err == nil || !strings.Contains(err.Error(), "expected payplug.Customer, got payplug.Payment") {
+		t.Fatalf("expected type error, got %v", err)
+	}
+}
+
+func TestMockReconcile(t *testing.T) {
+	m := new(Mock)
+	m.On("WalkPayments", []payplug.Payment{
+		{Id: "pay_1", IsPaid: true, Amount: 1000, AmountRefunded: 100, Metadata: payplug.Metadata{"order": "1"}},
+	}, nil)
+	m.On("ListRefunds", nil, payplug.NewClientError(errors.New("timeout")))
+
+	_, err := reconcile.Fetch(m, 0, 2000)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if calls := m.CallsTo("ListRefunds"); len(calls) != 1 || calls[0].Args[0] != "pay_1" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+}
@@ -0,0 +1,150 @@
+package payplug
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Pinning configures the public key pinning of the PayPlug API certificates.
+// The connection is accepted if any certificate of a verified chain
+// matches one of the pins.
+type Pinning struct {
+	Host       string // The pinned host, default to the host of API_BASE_URL
+	Primary    string // Base64 SHA-256 hash of the SubjectPublicKeyInfo (see SPKIPin)
+	Backup     string // Used when the primary key is rotated
+	ReportOnly bool   // Log mismatches instead of rejecting the connection
+}
+
+// PinningError is returned when the server certificates match no pin.
+type PinningError struct {
+	Host string
+	Got  []string // The pins of the first verified chain
+}
+
+func (p PinningError) Error() string {
+	return fmt.Sprintf("certificate pinning failed for %s: got %s", p.Host, strings.Join(p.Got, ", "))
+}
+
+// SPKIPin returns the pin of `cert`: the base64 SHA-256 hash of its SubjectPublicKeyInfo.
+func SPKIPin(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func (p Pinning) host() string {
+	if p.Host != "" {
+		return p.Host
+	}
+	return strings.TrimPrefix(API_BASE_URL, "https://")
+}
+
+// check verifies the `chains` built by the certificate verification for `host`,
+// logging or returning mismatches. The certificates sent by the server
+// but absent from the verified chains are never considered.
+func (p Pinning) check(host string, chains [][]*x509.Certificate, logger Logger) error {
+	if host != p.host() {
+		return nil
+	}
+	var got []string
+	for i, chain := range chains {
+		for _, cert := range chain {
+			pin := SPKIPin(cert)
+			if pin == p.Primary || (p.Backup != "" && pin == p.Backup) {
+				return nil
+			}
+			if i == 0 {
+				got = append(got, pin)
+			}
+		}
+	}
+	err := PinningError{Host: host, Got: got}
+	if p.ReportOnly {
+		if logger != nil {
+			logger.Printf("payplug: %s (report only)", err)
+		}
+		return nil
+	}
+	return err
+}
+
+// VerifyConnection returns a function suited for tls.Config.VerifyConnection,
+// checking the pins before any request is sent. It is meant for the custom
+// transports which are not an *http.Transport (see WithPinning).
+// The standard verification must be enabled, since only verified chains are
+// considered. Mismatches are logged to `logger` in report-only mode.
+func (p Pinning) VerifyConnection(logger Logger) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		return p.check(cs.ServerName, cs.VerifiedChains, logger)
+	}
+}
+
+// WithPinning enables public key pinning: certificates are checked during
+// the handshake, before any request is sent.
+// The transport must be an *http.Transport without custom TLS dialer:
+// otherwise, the requests of the session fail, and Pinning.VerifyConnection
+// should be installed in the TLS configuration of the transport instead.
+// Pinning mismatches are logged with the logger of the session in
+// report-only mode.
+func WithPinning(pinning Pinning) Option {
+	return func(c *config) { c.pinning = &pinning }
+}
+
+// errPinningTransport is returned by the requests when pinning
+// can't be enforced before sending them
+var errPinningTransport = errors.New("certificate pinning requires an *http.Transport without custom TLS dialer (see Pinning.VerifyConnection)")
+
+// errCABundleTransport is returned by the requests when the CA bundle
+// can't be used to verify the server certificates
+var errCABundleTransport = errors.New("CA bundle requires an *http.Transport without custom TLS dialer")
+
+// secure installs the certificate checks (CA bundle and pinning)
+// on `transport`. An error is returned if they can't be enforced.
+func (c *config) secure(transport http.RoundTripper) (http.RoundTripper, error) {
+	if c.pinning == nil && c.caBundle == nil {
+		return transport, nil
+	}
+	t, ok := transport.(*http.Transport)
+	if !ok || t.DialTLSContext != nil || t.DialTLS != nil {
+		if c.pinning != nil {
+			return nil, errPinningTransport
+		}
+		return nil, errCABundleTransport
+	}
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = new(tls.Config)
+	}
+	cfg := t.TLSClientConfig
+	bundle, pinning, logger := c.caBundle, c.pinning, c.session.logger
+	if bundle != nil {
+		// the standard verification is replaced by bundle.verify,
+		// since RootCAs may not be modified once in use
+		cfg.InsecureSkipVerify = true
+	}
+	previous := cfg.VerifyConnection
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if previous != nil {
+			if err := previous(cs); err != nil {
+				return err
+			}
+		}
+		chains := cs.VerifiedChains
+		if bundle != nil {
+			var err error
+			if chains, err = bundle.verify(cs); err != nil {
+				return err
+			}
+		}
+		if pinning == nil {
+			return nil
+		}
+		return pinning.check(cs.ServerName, chains, logger)
+	}
+	return t, nil
+}
@@ -0,0 +1,167 @@
+package payplug
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type wrappedTransport struct{ http.RoundTripper }
+
+// exampleTransport dials `api` for any address.
+// The test certificate is valid for example.com, which is needed
+// for the server name to be sent during the handshake.
+func exampleTransport(api *httptest.Server) *http.Transport {
+	t := api.Client().Transport.(*http.Transport).Clone()
+	t.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return new(net.Dialer).DialContext(ctx, network, api.Listener.Addr().String())
+	}
+	return t
+}
+
+var testSerial int64
+
+// newTestCert returns a certificate signed by `parent`, or self-signed
+// if `parent` is nil
+func newTestCert(t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(atomic.AddInt64(&testSerial, 1)),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if !isCA {
+		template.DNSNames = []string{name}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestPinning(t *testing.T) {
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Payment{Id: "pay_1"})
+	}))
+	defer api.Close()
+	pin := SPKIPin(api.Certificate())
+
+	base := exampleTransport(api)
+	const host = "example.com"
+	baseUrl := "https://" + host
+
+	s := NewSession("sk_test", WithBaseUrl(baseUrl), WithTransport(base),
+		WithPinning(Pinning{Host: host, Primary: "invalid", Backup: pin}))
+	if _, err := s.GetPayment("pay_1"); err != nil {
+		t.Fatal(err)
+	}
+
+	s = NewSession("sk_test", WithBaseUrl(baseUrl), WithTransport(base),
+		WithPinning(Pinning{Host: host, Primary: "invalid"}))
+	if _, err := s.GetPayment("pay_1"); err == nil || !strings.Contains(err.Error(), "pinning") {
+		t.Fatalf("expected pinning error, got %v", err)
+	}
+
+	var logs bytes.Buffer
+	s = NewSession("sk_test", WithBaseUrl(baseUrl), WithTransport(base), WithLogger(log.New(&logs, "", 0)),
+		WithPinning(Pinning{Host: host, Primary: "invalid", ReportOnly: true}))
+	if _, err := s.GetPayment("pay_1"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "report only") {
+		t.Fatalf("expected a report, got %s", logs.String())
+	}
+
+	// pinning can't be enforced before sending the request: refuse it
+	s = NewSession("sk_test", WithBaseUrl(baseUrl), WithTransport(wrappedTransport{base}),
+		WithPinning(Pinning{Host: host, Primary: pin}))
+	if _, err := s.GetPayment("pay_1"); err == nil || !strings.Contains(err.Error(), "requires an *http.Transport") {
+		t.Fatalf("expected transport error, got %v", err)
+	}
+
+	// with the hook installed in the custom transport
+	hooked := base.Clone()
+	hooked.TLSClientConfig.VerifyConnection = Pinning{Host: host, Primary: "invalid"}.VerifyConnection(nil)
+	s = NewSession("sk_test", WithBaseUrl(baseUrl), WithTransport(wrappedTransport{hooked}))
+	if _, err := s.GetPayment("pay_1"); err == nil || !strings.Contains(err.Error(), "pinning") {
+		t.Fatalf("expected pinning error, got %v", err)
+	}
+}
+
+// TestPinningVerifiedChain checks that a pinned certificate appended
+// to a valid chain, but not part of the verified path, is ignored.
+func TestPinningVerifiedChain(t *testing.T) {
+	const host = "example.com"
+	root, rootKey := newTestCert(t, "Test Root", true, nil, nil)
+	leaf, leafKey := newTestCert(t, host, false, root, rootKey)
+	pinned, _ := newTestCert(t, "Pinned", true, nil, nil)
+
+	api := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Payment{Id: "pay_1"})
+	}))
+	api.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{leaf.Raw, pinned.Raw},
+		PrivateKey:  leafKey,
+	}}}
+	api.StartTLS()
+	defer api.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	transport := exampleTransport(api)
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+
+	bundle := new(CABundle)
+	if err := bundle.Load(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]Option{
+		{WithTransport(transport)},
+		{WithTransport(exampleTransport(api)), WithCABundle(bundle)},
+	} {
+		s := NewSession("sk_test", append(opts, WithBaseUrl("https://"+host),
+			WithPinning(Pinning{Host: host, Primary: SPKIPin(pinned)}))...)
+		if _, err := s.GetPayment("pay_1"); err == nil || !strings.Contains(err.Error(), "pinning") {
+			t.Fatalf("expected pinning error, got %v", err)
+		}
+
+		s = NewSession("sk_test", append(opts, WithBaseUrl("https://"+host),
+			WithPinning(Pinning{Host: host, Primary: SPKIPin(root)}))...)
+		if _, err := s.GetPayment("pay_1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
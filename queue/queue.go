@@ -0,0 +1,397 @@
+// Package queue processes PayPlug notifications asynchronously.
+//
+// The HTTP handler acknowledges a notification as soon as it is written
+// to a local directory; worker goroutines then fetch the trusted object
+// and call the NotificationCallbacks. Failed notifications are retried with
+// an exponential backoff, and moved to a dead-letter directory after
+// the last attempt.
+//
+// Notifications are stored as one JSON file per job:
+//
+//	<dir>/pending/<id>.json
+//	<dir>/dead/<id>.json
+//
+// so that pending jobs survive a restart.
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+const maxBodySize = 1000000 // same limit as the payplug package
+
+// ErrClosed is returned when enqueuing on a closed Queue.
+var ErrClosed = errors.New("queue: closed")
+
+// Job is a queued notification.
+type Job struct {
+	Id          string
+	Body        json.RawMessage // The notification, as sent by PayPlug
+	ReceivedAt  time.Time
+	Attempts    int       // Number of failed attempts
+	NextAttempt time.Time // Zero for a new job
+	LastError   string
+}
+
+// Options configures a Queue. The zero value uses the defaults.
+type Options struct {
+	Workers     int            // Default to 4
+	MaxAttempts int            // Attempts before dead-lettering, default to 5
+	Backoff     time.Duration  // Delay before the first retry, doubled on each retry, default to 1s
+	MaxBackoff  time.Duration  // Maximum delay between two attempts, default to 1h
+	Logger      payplug.Logger // Optional
+}
+
+func (o *Options) setDefaults() {
+	if o.Workers <= 0 {
+		o.Workers = 4
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Hour
+	}
+}
+
+// Queue is a durable notification queue. It implements http.Handler,
+// and is safe for concurrent use.
+type Queue struct {
+	dir       string
+	client    payplug.Client
+	callbacks payplug.NotificationCallbacks
+	opts      Options
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	ready   []string               // ids of the jobs to process, in order
+	retries map[string]*time.Timer // jobs waiting for their next attempt
+	closing bool
+	workers sync.WaitGroup
+
+	processed func(Job) // called after each attempt, for tests
+}
+
+// Open starts a queue storing its jobs in `dir`, created if needed.
+// The pending jobs of a previous run are scheduled again.
+func Open(dir string, client payplug.Client, callbacks payplug.NotificationCallbacks, opts Options) (*Queue, error) {
+	opts.setDefaults()
+	for _, sub := range []string{"pending", "dead"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, fmt.Errorf("creating queue directory: %s", err)
+		}
+	}
+	q := &Queue{dir: dir, client: client, callbacks: callbacks, opts: opts, retries: map[string]*time.Timer{}}
+	q.cond = sync.NewCond(&q.mu)
+
+	jobs, err := q.list("pending")
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		q.schedule(job)
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q, nil
+}
+
+func (q *Queue) path(sub, id string) string {
+	return filepath.Join(q.dir, sub, id+".json")
+}
+
+// write stores `job` atomically, so that a crash never leaves a partial file
+func (q *Queue) write(sub string, job Job) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Join(q.dir, sub), "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), q.path(sub, job.Id))
+}
+
+func (q *Queue) read(sub, id string) (Job, error) {
+	var job Job
+	b, err := ioutil.ReadFile(q.path(sub, id))
+	if err != nil {
+		return job, err
+	}
+	err = json.Unmarshal(b, &job)
+	return job, err
+}
+
+// list returns the jobs of `sub`, sorted by reception time
+func (q *Queue) list(sub string) ([]Job, error) {
+	files, err := filepath.Glob(filepath.Join(q.dir, sub, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []Job
+	for _, file := range files {
+		job, err := q.read(sub, strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			return nil, fmt.Errorf("reading job %s: %s", file, err)
+		}
+		out = append(out, job)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ReceivedAt.Before(out[j].ReceivedAt) })
+	return out, nil
+}
+
+func newId() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generating job id: %s", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Enqueue stores the notification `body` and schedules its processing.
+// It returns once the job is durably written.
+func (q *Queue) Enqueue(body []byte) (Job, error) {
+	if _, err := payplug.NotificationObject(body); err != nil {
+		return Job{}, err
+	}
+	q.mu.Lock()
+	closing := q.closing
+	q.mu.Unlock()
+	if closing {
+		return Job{}, ErrClosed
+	}
+	id, err := newId()
+	if err != nil {
+		return Job{}, err
+	}
+	job := Job{Id: id, Body: append(json.RawMessage(nil), body...), ReceivedAt: time.Now()}
+	if err := q.write("pending", job); err != nil {
+		return Job{}, fmt.Errorf("storing notification: %s", err)
+	}
+	q.schedule(job)
+	return job, nil
+}
+
+// ServeHTTP acknowledges the notifications as soon as they are queued.
+// Invalid bodies are answered with 400, and notifications received
+// while closing with 503, so that PayPlug sends them again.
+func (q *Queue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err = payplug.NotificationObject(body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, err = q.Enqueue(body)
+	switch {
+	case err == ErrClosed:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		q.logf("queue: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (q *Queue) logf(format string, args ...interface{}) {
+	if q.opts.Logger != nil {
+		q.opts.Logger.Printf(format, args...)
+	}
+}
+
+// schedule adds `job` to the ready list, now or at its next attempt
+func (q *Queue) schedule(job Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closing {
+		return // kept on disk for the next run
+	}
+	if delay := time.Until(job.NextAttempt); delay > 0 {
+		q.retries[job.Id] = time.AfterFunc(delay, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			if _, ok := q.retries[job.Id]; !ok {
+				return // stopped by Close
+			}
+			delete(q.retries, job.Id)
+			q.ready = append(q.ready, job.Id)
+			q.cond.Signal()
+		})
+		return
+	}
+	q.ready = append(q.ready, job.Id)
+	q.cond.Signal()
+}
+
+// next blocks until a job is ready, and returns false
+// once the queue is closing and drained
+func (q *Queue) next() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.ready) == 0 && !q.closing {
+		q.cond.Wait()
+	}
+	if len(q.ready) == 0 {
+		return "", false
+	}
+	id := q.ready[0]
+	q.ready = q.ready[1:]
+	return id, true
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for {
+		id, ok := q.next()
+		if !ok {
+			return
+		}
+		job, err := q.read("pending", id)
+		if err != nil {
+			q.logf("queue: reading job %s: %s", id, err)
+			continue
+		}
+		job = q.process(job)
+		if q.processed != nil {
+			q.processed(job)
+		}
+	}
+}
+
+// permanent returns true for the errors which retrying won't fix
+func permanent(err error) bool {
+	var v payplug.ValidationError
+	return errors.As(err, &v)
+}
+
+// backoff returns the delay before the next attempt of a job
+// which failed `attempts` times, capped to MaxBackoff
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.opts.Backoff
+	for i := 1; i < attempts && delay < q.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.opts.MaxBackoff {
+		delay = q.opts.MaxBackoff
+	}
+	return delay
+}
+
+// process runs one attempt of `job`, and returns its updated state
+func (q *Queue) process(job Job) Job {
+	err := q.callbacks.Dispatch(q.client, job.Body)
+	if err == nil {
+		if err := os.Remove(q.path("pending", job.Id)); err != nil {
+			q.logf("queue: removing job %s: %s", job.Id, err)
+		}
+		return job
+	}
+
+	job.Attempts++
+	job.LastError = err.Error()
+	if job.Attempts >= q.opts.MaxAttempts || permanent(err) {
+		q.logf("queue: job %s dead after %d attempt(s): %s", job.Id, job.Attempts, err)
+		if err := q.write("dead", job); err != nil {
+			q.logf("queue: storing dead job %s: %s", job.Id, err)
+			return job
+		}
+		os.Remove(q.path("pending", job.Id))
+		return job
+	}
+
+	delay := q.backoff(job.Attempts)
+	job.NextAttempt = time.Now().Add(delay)
+	q.logf("queue: job %s failed (attempt %d), retrying in %s: %s", job.Id, job.Attempts, delay, err)
+	if err := q.write("pending", job); err != nil {
+		q.logf("queue: storing job %s: %s", job.Id, err)
+	}
+	q.schedule(job)
+	return job
+}
+
+// DeadLetters returns the jobs which failed their last attempt.
+func (q *Queue) DeadLetters() ([]Job, error) {
+	return q.list("dead")
+}
+
+// Requeue moves the dead job `id` back to the queue, for a new series of attempts.
+func (q *Queue) Requeue(id string) error {
+	job, err := q.read("dead", id)
+	if err != nil {
+		return fmt.Errorf("reading dead job: %s", err)
+	}
+	job.Attempts, job.NextAttempt = 0, time.Time{}
+	if err = q.write("pending", job); err != nil {
+		return err
+	}
+	if err = os.Remove(q.path("dead", id)); err != nil {
+		return err
+	}
+	q.schedule(job)
+	return nil
+}
+
+// Close stops accepting notifications and waits for the ready jobs
+// to be processed, or for `ctx` to be done. Jobs waiting for a retry
+// stay on disk, and are processed by the next Open.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	q.closing = true
+	for id, timer := range q.retries {
+		timer.Stop()
+		delete(q.retries, id)
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
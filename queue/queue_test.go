@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+	"github.com/benoitkugler/payplug-go/payplugtest"
+)
+
+const paymentBody = `{"id": "pay_1", "object": "payment"}`
+
+func TestQueue(t *testing.T) {
+	mock := new(payplugtest.Mock)
+	mock.On("HandleNotificationPayment", payplug.Payment{}, payplug.NewClientError(errors.New("network down")))
+	mock.On("HandleNotificationPayment", payplug.Payment{Id: "pay_1", IsPaid: true}, nil)
+
+	var (
+		mu   sync.Mutex
+		paid []string
+	)
+	callbacks := payplug.NotificationCallbacks{Payment: func(p payplug.Payment) error {
+		mu.Lock()
+		defer mu.Unlock()
+		paid = append(paid, p.Id)
+		return nil
+	}}
+	q, err := Open(t.TempDir(), mock, callbacks, Options{Workers: 2, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(q)
+	defer server.Close()
+	resp, err := http.Post(server.URL, "application/json", bytes.NewReader([]byte(paymentBody)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	resp, _ = http.Post(server.URL, "application/json", bytes.NewReader([]byte(`{"object": "customer"}`)))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		n := len(paid)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(paid) != 1 || len(mock.CallsTo("HandleNotificationPayment")) != 2 {
+		t.Fatalf("expected a retry then success, got %v", paid)
+	}
+	if err = q.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = q.Enqueue([]byte(paymentBody)); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestQueueDeadLetterAndRestart(t *testing.T) {
+	dir := t.TempDir()
+	mock := new(payplugtest.Mock)
+	mock.On("HandleNotificationRefund", payplug.Refund{}, payplug.NewHttpError(500, "internal error"))
+
+	// a closed queue keeps its jobs for the next run
+	q, err := Open(dir, mock, payplug.NotificationCallbacks{}, Options{MaxAttempts: 2, Backoff: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempted := make(chan Job, 1)
+	q.processed = func(job Job) { attempted <- job }
+	job, err := q.Enqueue([]byte(`{"id": "re_1", "object": "refund"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-attempted // first attempt
+	if err = q.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := q.list("pending")
+	if err != nil || len(pending) != 1 || pending[0].Attempts != 1 {
+		t.Fatalf("unexpected pending jobs %v (%v)", pending, err)
+	}
+
+	// reopening schedules the pending job; a past retry date runs it now
+	pending[0].NextAttempt = time.Now()
+	if err = q.write("pending", pending[0]); err != nil {
+		t.Fatal(err)
+	}
+	q, err = Open(dir, mock, payplug.NotificationCallbacks{}, Options{MaxAttempts: 2, Backoff: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = q.Close(context.Background()); err != nil { // drains the ready job
+		t.Fatal(err)
+	}
+	dead, err := q.DeadLetters()
+	if err != nil || len(dead) != 1 || dead[0].Id != job.Id || dead[0].Attempts != 2 {
+		t.Fatalf("unexpected dead letters %v (%v)", dead, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	opts := Options{Backoff: time.Second, MaxBackoff: time.Minute}
+	opts.setDefaults()
+	q := &Queue{opts: opts}
+	for _, test := range []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{6, 32 * time.Second},
+		{7, time.Minute},
+		{100, time.Minute}, // no overflow
+	} {
+		if d := q.backoff(test.attempts); d != test.delay {
+			t.Errorf("attempt %d: expected %s, got %s", test.attempts, test.delay, d)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package payplug
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// RawJSON keeps the JSON a resource was decoded from, so that
+// fields not yet modelled by this package remain reachable.
+// Resources refer to it with a pointer, nil for the resources
+// not decoded from JSON, so that they remain comparable.
+// The unknown fields are written back when the resource is marshalled,
+// so that stored resources round-trip; the requests creating resources
+// only send the modelled fields.
+type RawJSON struct {
+	raw     json.RawMessage
+	unknown map[string]json.RawMessage
+}
+
+// Bytes returns the JSON the resource was decoded from, or nil.
+func (r *RawJSON) Bytes() json.RawMessage {
+	if r == nil {
+		return nil
+	}
+	return r.raw
+}
+
+// Unknown returns the fields not modelled by the resource type, by JSON name.
+func (r *RawJSON) Unknown() map[string]json.RawMessage {
+	if r == nil {
+		return nil
+	}
+	return r.unknown
+}
+
+// Get decodes the field `name` of the original JSON into `out`,
+// and returns false if it is absent.
+func (r *RawJSON) Get(name string, out interface{}) (bool, error) {
+	if r == nil || r.raw == nil {
+		return false, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(r.raw, &fields); err != nil {
+		return false, err
+	}
+	v, ok := fields[name]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(v, out); err != nil {
+		return true, fmt.Errorf("decoding field %s: %s", name, err)
+	}
+	return true, nil
+}
+
+var rawJSONType = reflect.TypeOf((*RawJSON)(nil))
+
+// hasRawJSON returns true for the struct types keeping their JSON
+func hasRawJSON(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type == rawJSONType {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRaw decodes `b` into `v`, a pointer to a type without custom
+// decoding, and records `b` and its unknown fields in `raw`.
+func decodeRaw(b []byte, v interface{}, raw **RawJSON) error {
+	if err := json.Unmarshal(b, v); err != nil {
+		return err
+	}
+	*raw = nil
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil || fields == nil {
+		return err // null is accepted by v
+	}
+	r := &RawJSON{raw: append(json.RawMessage(nil), b...)}
+	*raw = r
+	known := jsonFields(reflect.TypeOf(v).Elem())
+	for name, value := range fields {
+		if _, ok := known[name]; ok {
+			continue
+		}
+		if r.unknown == nil {
+			r.unknown = map[string]json.RawMessage{}
+		}
+		r.unknown[name] = value
+	}
+	return nil
+}
+
+// encodeRaw marshals `v`, a type without custom encoding,
+// adding the unknown fields of `raw`.
+func encodeRaw(v interface{}, raw *RawJSON) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil || len(raw.Unknown()) == 0 {
+		return b, err
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range raw.Unknown() {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// The resources keep their JSON: the plain types below
+// drop the methods, to avoid infinite recursion.
+
+func (p *Payment) UnmarshalJSON(b []byte) error {
+	type plain Payment
+	return decodeRaw(b, (*plain)(p), &p.Raw)
+}
+
+func (p Payment) MarshalJSON() ([]byte, error) {
+	type plain Payment
+	return encodeRaw(plain(p), p.Raw)
+}
+
+func (r *Refund) UnmarshalJSON(b []byte) error {
+	type plain Refund
+	return decodeRaw(b, (*plain)(r), &r.Raw)
+}
+
+func (r Refund) MarshalJSON() ([]byte, error) {
+	type plain Refund
+	return encodeRaw(plain(r), r.Raw)
+}
+
+func (a *AccountingReport) UnmarshalJSON(b []byte) error {
+	type plain AccountingReport
+	return decodeRaw(b, (*plain)(a), &a.Raw)
+}
+
+func (a AccountingReport) MarshalJSON() ([]byte, error) {
+	type plain AccountingReport
+	return encodeRaw(plain(a), a.Raw)
+}
+
+func (c *Customer) UnmarshalJSON(b []byte) error {
+	type plain Customer
+	return decodeRaw(b, (*plain)(c), &c.Raw)
+}
+
+func (c Customer) MarshalJSON() ([]byte, error) {
+	type plain Customer
+	return encodeRaw(plain(c), c.Raw)
+}
+
+func (c *Card) UnmarshalJSON(b []byte) error {
+	type plain Card
+	return decodeRaw(b, (*plain)(c), &c.Raw)
+}
+
+func (c Card) MarshalJSON() ([]byte, error) {
+	type plain Card
+	return encodeRaw(plain(c), c.Raw)
+}
+
+func (i *InstallmentPlan) UnmarshalJSON(b []byte) error {
+	type plain InstallmentPlan
+	return decodeRaw(b, (*plain)(i), &i.Raw)
+}
+
+func (i InstallmentPlan) MarshalJSON() ([]byte, error) {
+	type plain InstallmentPlan
+	return encodeRaw(plain(i), i.Raw)
+}
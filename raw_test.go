@@ -0,0 +1,79 @@
+package payplug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRawJSON(t *testing.T) {
+	var p Payment
+	if err := json.Unmarshal([]byte(paymentFixture), &p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Raw.Bytes()) == 0 {
+		t.Fatal("missing raw JSON")
+	}
+	var future struct {
+		Name string `json:"name"`
+	}
+	in := `{"id": "pay_1", "object": "payment", "amount": 1000, "future_field": {"name": "new"}}`
+	if err := json.Unmarshal([]byte(in), &p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Raw.Unknown()) != 1 {
+		t.Fatalf("unexpected unknown fields %v", p.Raw.Unknown())
+	}
+	if ok, err := p.Raw.Get("future_field", &future); !ok || err != nil || future.Name != "new" {
+		t.Fatalf("unexpected field %v %v %v", ok, err, future)
+	}
+
+	// unknown fields round-trip
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Payment
+	if err = json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.Id != "pay_1" || back.Amount != 1000 || string(back.Raw.Unknown()["future_field"]) != `{"name":"new"}` {
+		t.Fatalf("round trip failed: %s", b)
+	}
+
+	var report AccountingReport
+	if report.Raw.Bytes() != nil || !reflect.TypeOf(report).Comparable() {
+		t.Fatal("resources without maps should be comparable")
+	}
+
+	var list RefundList
+	if err = json.Unmarshal([]byte(`{"object": "list", "data": [{"id": "re_1", "extra": 1}]}`), &list); err != nil {
+		t.Fatal(err)
+	}
+	if string(list.Data[0].Raw.Unknown()["extra"]) != "1" {
+		t.Fatalf("unexpected unknown fields %v", list.Data[0].Raw.Unknown())
+	}
+}
+
+func TestRawJSONRequests(t *testing.T) {
+	var body map[string]interface{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"id": "pay_2"}`))
+	}))
+	defer api.Close()
+
+	var p Payment
+	if err := json.Unmarshal([]byte(`{"amount": 1000, "currency": "EUR", "future_field": 1}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession("sk_test", WithBaseUrl(api.URL))
+	if _, err := s.CreatePayment(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["future_field"]; ok || body["amount"] != 1000. {
+		t.Fatalf("unexpected request body %v", body)
+	}
+}
@@ -0,0 +1,168 @@
+// Package reconcile compares an internal ledger with the payments
+// and refunds known by PayPlug.
+//
+// Local orders are matched with PayPlug payments through a metadata key,
+// which must be set when creating the payments.
+package reconcile
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+// Order is an order record of the internal ledger.
+type Order struct {
+	Id       string // Value of the metadata key used to tag the payments
+	Amount   uint   // Expected paid amount, in cents
+	Refunded uint   // Expected refunded amount, in cents
+}
+
+// Statement is the PayPlug side of the reconciliation.
+type Statement struct {
+	Payments []payplug.Payment
+	Refunds  []payplug.Refund
+}
+
+// Fetch lists the payments created between `from` and `to` (inclusive),
+// and all their refunds, whatever their date.
+// Since PayPlug only lists refunds by payment, the refunds made in the range
+// for payments created before `from` are not fetched: `from` should be
+// early enough to include the payments which may be refunded in the range.
+func Fetch(s payplug.Client, from, to payplug.Timestamp) (Statement, error) {
+	var out Statement
+	err := s.WalkPayments(from, to, func(p payplug.Payment) error {
+		out.Payments = append(out.Payments, p)
+		if p.AmountRefunded == 0 {
+			return nil
+		}
+		refunds, err := s.ListRefunds(p.Id)
+		if err != nil {
+			return fmt.Errorf("listing refunds of %s: %s", p.Id, err)
+		}
+		out.Refunds = append(out.Refunds, refunds.Data...)
+		return nil
+	})
+	return out, err
+}
+
+// metadataString returns the order id stored in a metadata value,
+// formatting numbers as DecodeMetadata does (1e6 is "1000000")
+func metadataString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// Kind is the type of a discrepancy.
+type Kind uint8
+
+const (
+	MissingPayment   Kind = iota + 1 // The order has no paid payment on PayPlug
+	AmountMismatch                   // The paid amount differs from the order amount
+	UnexpectedRefund                 // PayPlug refunded more than the ledger expects
+	UnknownPayment                   // The payment is paid on PayPlug but has no matching order
+)
+
+func (k Kind) String() string {
+	switch k {
+	case MissingPayment:
+		return "missing payment"
+	case AmountMismatch:
+		return "amount mismatch"
+	case UnexpectedRefund:
+		return "unexpected refund"
+	case UnknownPayment:
+		return "unknown payment"
+	}
+	return fmt.Sprintf("Kind(%d)", k)
+}
+
+// Discrepancy is a difference between the ledger and PayPlug.
+type Discrepancy struct {
+	Kind       Kind
+	OrderId    string   // empty for UnknownPayment
+	PaymentIds []string // the PayPlug payments involved, if any
+	Expected   uint     // amount found in the ledger, in cents
+	Got        uint     // amount found on PayPlug, in cents
+}
+
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%s: order %q, payments %v (expected %d, got %d)",
+		d.Kind, d.OrderId, d.PaymentIds, d.Expected, d.Got)
+}
+
+// Report is the result of a reconciliation, sorted by order id.
+type Report []Discrepancy
+
+// Reconcile compares `orders` with `statement`. Payments are matched with
+// orders through their `key` metadata. Only paid payments are considered.
+func Reconcile(orders []Order, statement Statement, key string) Report {
+	type side struct {
+		payments []string
+		paid     uint
+		refunded uint
+	}
+	byOrder := map[string]*side{}
+	paymentToOrder := map[string]string{}
+	var out Report
+	for _, p := range statement.Payments {
+		if !p.IsPaid {
+			continue
+		}
+		v, ok := p.Metadata[key]
+		if !ok || v == nil {
+			out = append(out, Discrepancy{Kind: UnknownPayment, PaymentIds: []string{p.Id}, Got: p.Amount})
+			continue
+		}
+		id := metadataString(v)
+		sd := byOrder[id]
+		if sd == nil {
+			sd = new(side)
+			byOrder[id] = sd
+		}
+		sd.payments = append(sd.payments, p.Id)
+		sd.paid += p.Amount
+		paymentToOrder[p.Id] = id
+	}
+	for _, r := range statement.Refunds {
+		if id, ok := paymentToOrder[r.PaymentId]; ok {
+			byOrder[id].refunded += r.Amount
+		}
+	}
+
+	known := map[string]bool{}
+	for _, o := range orders {
+		known[o.Id] = true
+		sd := byOrder[o.Id]
+		if sd == nil {
+			out = append(out, Discrepancy{Kind: MissingPayment, OrderId: o.Id, Expected: o.Amount})
+			continue
+		}
+		if sd.paid != o.Amount {
+			out = append(out, Discrepancy{Kind: AmountMismatch, OrderId: o.Id, PaymentIds: sd.payments, Expected: o.Amount, Got: sd.paid})
+		}
+		if sd.refunded > o.Refunded {
+			out = append(out, Discrepancy{Kind: UnexpectedRefund, OrderId: o.Id, PaymentIds: sd.payments, Expected: o.Refunded, Got: sd.refunded})
+		}
+	}
+	for id, sd := range byOrder {
+		if !known[id] {
+			out = append(out, Discrepancy{Kind: UnknownPayment, OrderId: id, PaymentIds: sd.payments, Got: sd.paid})
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].OrderId != out[j].OrderId {
+			return out[i].OrderId < out[j].OrderId
+		}
+		return out[i].Kind < out[j].Kind
+	})
+	return out
+}
@@ -0,0 +1,45 @@
+package reconcile
+
+import (
+	"reflect"
+	"testing"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+func TestReconcile(t *testing.T) {
+	orders := []Order{
+		{Id: "1", Amount: 1000},
+		{Id: "2", Amount: 2000},
+		{Id: "3", Amount: 3000, Refunded: 500},
+		{Id: "4", Amount: 4000},
+		{Id: "1000000", Amount: 7000},
+	}
+	st := Statement{
+		Payments: []payplug.Payment{
+			{Id: "pay_1", IsPaid: true, Amount: 1000, Metadata: payplug.Metadata{"order": 1.}},
+			{Id: "pay_2a", IsPaid: true, Amount: 1000, Metadata: payplug.Metadata{"order": "2"}},
+			{Id: "pay_2b", IsPaid: true, Amount: 500, Metadata: payplug.Metadata{"order": "2"}},
+			{Id: "pay_3", IsPaid: true, Amount: 3000, Metadata: payplug.Metadata{"order": "3"}},
+			{Id: "pay_4", IsPaid: false, Amount: 4000, Metadata: payplug.Metadata{"order": "4"}},
+			{Id: "pay_5", IsPaid: true, Amount: 5000, Metadata: payplug.Metadata{"order": "5"}},
+			{Id: "pay_6", IsPaid: true, Amount: 6000},
+			{Id: "pay_7", IsPaid: true, Amount: 7000, Metadata: payplug.Metadata{"order": 1e6}},
+		},
+		Refunds: []payplug.Refund{
+			{Id: "re_1", PaymentId: "pay_1", Amount: 200},
+			{Id: "re_3", PaymentId: "pay_3", Amount: 500},
+		},
+	}
+	got := Reconcile(orders, st, "order")
+	exp := Report{
+		{Kind: UnknownPayment, PaymentIds: []string{"pay_6"}, Got: 6000},
+		{Kind: UnexpectedRefund, OrderId: "1", PaymentIds: []string{"pay_1"}, Expected: 0, Got: 200},
+		{Kind: AmountMismatch, OrderId: "2", PaymentIds: []string{"pay_2a", "pay_2b"}, Expected: 2000, Got: 1500},
+		{Kind: MissingPayment, OrderId: "4", Expected: 4000},
+		{Kind: UnknownPayment, OrderId: "5", PaymentIds: []string{"pay_5"}, Got: 5000},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("expected\n%v\ngot\n%v", exp, got)
+	}
+}
@@ -0,0 +1,141 @@
+package payplug
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MinRefundAmount is the minimum amount of a refund, in cents.
+const MinRefundAmount = 10
+
+// PlannedRefund is one refund operation of a RefundPlan.
+type PlannedRefund struct {
+	PaymentId string
+	Amount    Money
+}
+
+// RefundPlan spreads a refund over the payments of an order.
+type RefundPlan []PlannedRefund
+
+// Total returns the amount refunded by the plan.
+func (plan RefundPlan) Total() (Money, error) {
+	amounts := make([]Money, len(plan))
+	for i, r := range plan {
+		amounts[i] = r.Amount
+	}
+	return Sum(amounts...)
+}
+
+// refundableAt returns the amount of `p` which may be refunded at `now`.
+func (p Payment) refundableAt(now time.Time) uint {
+	if !p.IsPaid || p.IsRefunded || p.AmountRefunded >= p.Amount {
+		return 0
+	}
+	t := Timestamp(now.Unix())
+	if (p.RefundableAfter != 0 && t < p.RefundableAfter) || (p.RefundableUntil != 0 && t > p.RefundableUntil) {
+		return 0
+	}
+	return p.Amount - p.AmountRefunded
+}
+
+// PlanRefunds computes the refunds needed to give back `target` from
+// the `payments` of an order, at time `now`.
+// Only paid payments within their refund window are used, starting
+// with the ones whose window closes first, and no refund is lower
+// than MinRefundAmount.
+func PlanRefunds(payments []Payment, target Money, now time.Time) (RefundPlan, error) {
+	type candidate struct {
+		payment    Payment
+		refundable uint
+	}
+	var (
+		candidates []candidate
+		available  uint
+	)
+	for _, p := range payments {
+		if p.Currency != target.Currency {
+			return nil, CurrencyMismatch{target.Currency, p.Currency}
+		}
+		if r := p.refundableAt(now); r >= MinRefundAmount {
+			candidates = append(candidates, candidate{p, r})
+			available += r
+		}
+	}
+	if target.Value < MinRefundAmount {
+		return nil, fmt.Errorf("refund of %s is below the minimum of %s", target, Money{MinRefundAmount, target.Currency})
+	}
+	if available < target.Value {
+		return nil, fmt.Errorf("only %s may be refunded, %s requested", Money{available, target.Currency}, target)
+	}
+	// windows closing first; no window means no deadline
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ui, uj := candidates[i].payment.RefundableUntil, candidates[j].payment.RefundableUntil
+		return ui != 0 && (uj == 0 || ui < uj)
+	})
+
+	var plan RefundPlan
+	remaining := target.Value
+	for i, c := range candidates {
+		if remaining == 0 {
+			break
+		}
+		take := c.refundable
+		if take > remaining {
+			take = remaining
+		}
+		// keep enough for the next refunds if the rest would be too small
+		if rest := remaining - take; rest != 0 && rest < MinRefundAmount && i+1 < len(candidates) {
+			take -= MinRefundAmount - rest
+		}
+		if take < MinRefundAmount {
+			continue
+		}
+		plan = append(plan, PlannedRefund{PaymentId: c.payment.Id, Amount: Money{take, target.Currency}})
+		remaining -= take
+	}
+	if remaining != 0 {
+		return nil, fmt.Errorf("can't split %s in refunds of at least %s", target, Money{MinRefundAmount, target.Currency})
+	}
+	return plan, nil
+}
+
+// RefundOutcome is the result of one planned refund.
+type RefundOutcome struct {
+	Planned PlannedRefund
+	Refund  Refund // valid if Err is nil
+	Err     error
+}
+
+// RefundPlanError is returned when some refunds of a plan failed.
+type RefundPlanError struct {
+	Failed      []RefundOutcome
+	NotRefunded Money
+}
+
+func (e RefundPlanError) Error() string {
+	return fmt.Sprintf("%d refund(s) failed, %s not refunded (first error: %s)",
+		len(e.Failed), e.NotRefunded, e.Failed[0].Err)
+}
+
+// ExecuteRefundPlan creates the refunds of `plan`, attaching `metadata`
+// to each of them. A failed refund does not stop the following ones:
+// the outcome of every refund is returned, with a RefundPlanError if
+// some of them failed.
+func (s Session) ExecuteRefundPlan(plan RefundPlan, metadata Metadata) ([]RefundOutcome, error) {
+	outcomes := make([]RefundOutcome, len(plan))
+	var failed []RefundOutcome
+	notRefunded := Money{}
+	for i, planned := range plan {
+		r, err := s.CreateRefund(planned.PaymentId, Refund{Amount: planned.Amount.Value, Metadata: metadata})
+		outcomes[i] = RefundOutcome{Planned: planned, Refund: r, Err: err}
+		if err != nil {
+			failed = append(failed, outcomes[i])
+			notRefunded = Money{notRefunded.Value + planned.Amount.Value, planned.Amount.Currency}
+		}
+	}
+	if len(failed) != 0 {
+		return outcomes, RefundPlanError{Failed: failed, NotRefunded: notRefunded}
+	}
+	return outcomes, nil
+}
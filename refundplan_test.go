@@ -0,0 +1,77 @@
+package payplug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanRefunds(t *testing.T) {
+	now := time.Unix(1000, 0)
+	payments := []Payment{
+		{Id: "pay_late", IsPaid: true, Amount: 1000, Currency: Eur, RefundableUntil: 5000},
+		{Id: "pay_soon", IsPaid: true, Amount: 1000, AmountRefunded: 400, Currency: Eur, RefundableUntil: 2000},
+		{Id: "pay_closed", IsPaid: true, Amount: 1000, Currency: Eur, RefundableUntil: 500},
+		{Id: "pay_unpaid", Amount: 1000, Currency: Eur},
+	}
+	plan, err := PlanRefunds(payments, Money{1000, Eur}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := RefundPlan{{"pay_soon", Money{600, Eur}}, {"pay_late", Money{400, Eur}}}
+	if !reflect.DeepEqual(plan, exp) {
+		t.Fatalf("expected %v, got %v", exp, plan)
+	}
+
+	// the rest on pay_late would be 5 cents: take less on pay_soon
+	plan, err = PlanRefunds(payments, Money{605, Eur}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp = RefundPlan{{"pay_soon", Money{595, Eur}}, {"pay_late", Money{10, Eur}}}
+	if !reflect.DeepEqual(plan, exp) {
+		t.Fatalf("expected %v, got %v", exp, plan)
+	}
+
+	if _, err = PlanRefunds(payments, Money{2000, Eur}, now); err == nil {
+		t.Fatal("expected error for insufficient refundable amount")
+	}
+	if _, err = PlanRefunds(payments, Money{5, Eur}, now); err == nil {
+		t.Fatal("expected error for amount below minimum")
+	}
+	if _, err = PlanRefunds(payments, Money{100, Usd}, now); err == nil {
+		t.Fatal("expected error for currency mismatch")
+	}
+}
+
+func TestExecuteRefundPlan(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "pay_bad") {
+			http.Error(w, `{"message": "not refundable"}`, http.StatusBadRequest)
+			return
+		}
+		var body Refund
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(Refund{Id: "re_1", Amount: body.Amount, Currency: Eur})
+	}))
+	defer api.Close()
+	s := NewSession("sk_test")
+	s.SetBaseUrl(api.URL)
+
+	plan := RefundPlan{{"pay_ok", Money{600, Eur}}, {"pay_bad", Money{400, Eur}}}
+	outcomes, err := s.ExecuteRefundPlan(plan, nil)
+	planErr, ok := err.(RefundPlanError)
+	if !ok {
+		t.Fatalf("expected RefundPlanError, got %v", err)
+	}
+	if planErr.NotRefunded != (Money{400, Eur}) || len(planErr.Failed) != 1 {
+		t.Fatalf("unexpected error %v", planErr)
+	}
+	if outcomes[0].Err != nil || outcomes[0].Refund.Amount != 600 {
+		t.Fatalf("unexpected outcome %v", outcomes[0])
+	}
+}
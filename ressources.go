@@ -6,10 +6,13 @@ import (
 
 type Timestamp uint // unix timestamp, zero corresponds to null value
 
-type Currency string // three-letter ISO 4217
+type Currency string // three-letter ISO 4217, see currency.go
 
 const (
 	Eur Currency = "EUR"
+	Usd Currency = "USD"
+	Gbp Currency = "GBP"
+	Chf Currency = "CHF"
 )
 
 type Brand string
@@ -67,7 +70,7 @@ func (ot *OptionnalAuthorization) UnmarshalJSON(b []byte) error {
 }
 
 type CardPayment struct {
-	Last4    string `json:"last_4,omitempty"`    // Last 4 digits of the card number.
+	Last4    string `json:"last4,omitempty"`     // Last 4 digits of the card number.
 	Country  string `json:"country,omitempty"`   // Country code (two-letter ISO 3166).
 	ExpYear  int    `json:"exp_year,omitempty"`  // Credit card expiration year.
 	ExpMonth int    `json:"exp_month,omitempty"` // Credit card expiration month.
@@ -111,10 +114,11 @@ type Shipping struct {
 }
 
 type HostedPayment struct {
-	PaymentUrl string `json:"payment_url,omitempty"` // The payment URL you should redirect your customer to.
-	ReturnUrl  string `json:"return_url,omitempty"`  // The URL the customer will be redirected to after the payment page whether it succeeds or not.
-	CancelUrl  string `json:"cancel_url,omitempty"`  // The URL the customer will redirected to after a click on ‘Cancel Payment’.
-	SentBy     string `json:"sent_by,omitempty"`     // By what means the payment URL was sent to the customer, if any.
+	PaymentUrl string    `json:"payment_url,omitempty"` // The payment URL you should redirect your customer to.
+	ReturnUrl  string    `json:"return_url,omitempty"`  // The URL the customer will be redirected to after the payment page whether it succeeds or not.
+	CancelUrl  string    `json:"cancel_url,omitempty"`  // The URL the customer will redirected to after a click on ‘Cancel Payment’.
+	PaidAt     Timestamp `json:"paid_at,omitempty"`     // Date at which the payment has been paid on the payment page, if any.
+	SentBy     string    `json:"sent_by,omitempty"`     // By what means the payment URL was sent to the customer, if any.
 }
 
 type NotificationState struct {
@@ -171,13 +175,13 @@ func (ot *OptionnalFailure) UnmarshalJSON(b []byte) error {
 }
 
 // Metadata are custom key/value pairs added by the user when creating
-// objects.
+// objects. See EncodeMetadata and DecodeMetadata for a typed access.
 type Metadata map[string]interface{}
 
-type OneyPaiement struct {
-	Type      string `json:"type,omitempty"`       // the type of payment made, either oney_x3_with_fees or oney_x4_with_fees.
-	IsPending bool   `json:"is_pending,omitempty"` // whether the payment is in a pending state for Oney. If this is true, it means that the payer has successfully filled out Oney’s payment form, but Oney is still analyzing the payer’s file. In this case, the payment is neither authorized nor paid yet, but in a pending state. If a notification_url is set, then the payment resource will be posted to it once Oney has made its decision. See Interpreting an Oney payment status.
-}
+// OneyPaiement is kept for compatibility.
+//
+// Deprecated: use PaymentMethod.
+type OneyPaiement = PaymentMethod
 
 // Payment is the Payplug payment object.
 type Payment struct {
@@ -205,10 +209,16 @@ type Payment struct {
 	Failure           OptionnalFailure       `json:"failure,omitempty"`             // Information for unsuccessful payments.
 	Description       string                 `json:"description,omitempty"`         // OPTIONAL Description shown to the customer.
 	Metadata          Metadata               `json:"metadata,omitempty"`            // Custom metadata object added when creating the payment.
-	PaymentMethod     OneyPaiement           `json:"payment_method,omitempty"`      // Data about the payment method, only available for Oney payments.
+	PaymentMethod     PaymentMethod          `json:"payment_method,omitempty"`      // The payment method to use at creation, or data about the payment method used. Empty for card payments.
+	PaymentContext    *PaymentContext        `json:"payment_context,omitempty"`     // OPTIONAL Additional data required by some payment methods at creation.
 	NotificationUrl   string                 `json:"notification_url,omitempty"`    // The URL PayPlug will send notifications to.
+	Initiator         Initiator              `json:"initiator,omitempty"`           // OPTIONAL Who triggers the payment, PAYER or MERCHANT. See SetInitiator.
+	Force3ds          *bool                  `json:"force_3ds,omitempty"`           // OPTIONAL At creation, forces (true) or disables (false) 3-D Secure. nil lets PayPlug decide.
+	ScaExemption      ScaExemption           `json:"sca_exemption,omitempty"`       // OPTIONAL SCA exemption requested for a payer-initiated payment.
 
 	Notification NotificationState `json:"notification,omitempty"` // Data related to notifications
+
+	Raw *RawJSON `json:"-"` // The JSON the object was decoded from, with its unknown fields
 }
 
 type Refund struct {
@@ -220,6 +230,8 @@ type Refund struct {
 	Currency  Currency  `json:"currency,omitempty"`   // Currency code three-letter ISO 4217 in which the refund was made.
 	CreatedAt Timestamp `json:"created_at,omitempty"` // Date of creation of the refund.
 	Metadata  Metadata  `json:"metadata,omitempty"`   // Custom metadata object added to the request the object.
+
+	Raw *RawJSON `json:"-"` // The JSON the object was decoded from, with its unknown fields
 }
 
 type AccountingReport struct {
@@ -231,4 +243,99 @@ type AccountingReport struct {
 	StartDate          string    `json:"start_date,omitempty"`           // date (ISO 8601)	Your report’s start date. The report will cover all operations from the beginning of that day (UTC).
 	EndDate            string    `json:"end_date,omitempty"`             // date (ISO 8601)	Your report’s end date. The report will cover all operations until the end of that day (UTC).
 	NotificationUrl    string    `json:"notification_url,omitempty"`     // OPTIONAL	The URL PayPlug will send a notification to.
+
+	Raw *RawJSON `json:"-"` // The JSON the object was decoded from, with its unknown fields
+}
+
+// PaymentList is one page of the payments list.
+type PaymentList struct {
+	Object  string    `json:"object,omitempty"`   // Value is: list.
+	Page    int       `json:"page,omitempty"`     // Index of the page, starting at 0.
+	PerPage int       `json:"per_page,omitempty"` // Number of payments per page.
+	HasMore bool      `json:"has_more,omitempty"` // true if there are more payments on the next page.
+	Data    []Payment `json:"data,omitempty"`     // The payments of the page.
+}
+
+// RefundList is the list of the refunds of a payment.
+type RefundList struct {
+	Object string   `json:"object,omitempty"` // Value is: list.
+	Data   []Refund `json:"data,omitempty"`   // The refunds of the payment.
+}
+
+// Customer is a customer saved on PayPlug, to which cards may be attached.
+type Customer struct {
+	Id        string    `json:"id,omitempty"`         // Customer ID.
+	Object    string    `json:"object,omitempty"`     // Value is: customer.
+	IsLive    bool      `json:"is_live,omitempty"`    // true for a customer in LIVE mode, false in TEST mode.
+	Email     string    `json:"email,omitempty"`      // Customer email address.
+	FirstName string    `json:"first_name,omitempty"` // Customer first name.
+	LastName  string    `json:"last_name,omitempty"`  // Customer last name.
+	Address1  string    `json:"address1,omitempty"`   // Customer address line 1.
+	Address2  string    `json:"address2,omitempty"`   // Customer address line 2.
+	Postcode  string    `json:"postcode,omitempty"`   // Customer Zip/Postal code.
+	City      string    `json:"city,omitempty"`       // Customer city.
+	Country   string    `json:"country,omitempty"`    // Customer country code (two-letter ISO 3166).
+	CreatedAt Timestamp `json:"created_at,omitempty"` // Creation date.
+	Metadata  Metadata  `json:"metadata,omitempty"`   // Custom metadata object added when creating the customer.
+
+	Raw *RawJSON `json:"-"` // The JSON the object was decoded from, with its unknown fields
+}
+
+// CustomerList is one page of the customers list.
+type CustomerList struct {
+	Object  string     `json:"object,omitempty"`   // Value is: list.
+	Page    int        `json:"page,omitempty"`     // Index of the page, starting at 0.
+	PerPage int        `json:"per_page,omitempty"` // Number of customers per page.
+	HasMore bool       `json:"has_more,omitempty"` // true if there are more customers on the next page.
+	Data    []Customer `json:"data,omitempty"`     // The customers of the page.
+}
+
+// Card is a card saved for a customer.
+type Card struct {
+	Id         string    `json:"id,omitempty"`          // Card ID.
+	Object     string    `json:"object,omitempty"`      // Value is: card.
+	IsLive     bool      `json:"is_live,omitempty"`     // true for a card in LIVE mode, false in TEST mode.
+	CustomerId string    `json:"customer_id,omitempty"` // ID of the customer owning the card.
+	Last4      string    `json:"last4,omitempty"`       // Last 4 digits of the card number.
+	Country    string    `json:"country,omitempty"`     // Country code (two-letter ISO 3166).
+	ExpYear    int       `json:"exp_year,omitempty"`    // Card expiration year.
+	ExpMonth   int       `json:"exp_month,omitempty"`   // Card expiration month.
+	Brand      Brand     `json:"brand,omitempty"`       // Card brand, can be Mastercard, Maestro, Visa or CB.
+	CreatedAt  Timestamp `json:"created_at,omitempty"`  // Creation date.
+	Metadata   Metadata  `json:"metadata,omitempty"`    // Custom metadata object added when saving the card.
+
+	Raw *RawJSON `json:"-"` // The JSON the object was decoded from, with its unknown fields
+}
+
+// CardList is the list of the cards of a customer.
+type CardList struct {
+	Object string `json:"object,omitempty"` // Value is: list.
+	Data   []Card `json:"data,omitempty"`   // The cards of the customer.
+}
+
+// ScheduleItem is one installment of an installment plan.
+type ScheduleItem struct {
+	Date       string   `json:"date,omitempty"`        // date (ISO 8601) at which the installment is due.
+	Amount     uint     `json:"amount,omitempty"`      // Positive amount of the installment in cents.
+	PaymentIds []string `json:"payment_ids,omitempty"` // IDs of the payments made for this installment.
+}
+
+// InstallmentPlan splits a payment into several installments.
+type InstallmentPlan struct {
+	Id            string            `json:"id,omitempty"`             // Installment plan ID.
+	Object        string            `json:"object,omitempty"`         // Value is: installment_plan.
+	IsLive        bool              `json:"is_live,omitempty"`        // true for an installment plan in LIVE mode, false in TEST mode.
+	IsActive      bool              `json:"is_active,omitempty"`      // true if the installment plan is still running.
+	IsFullyPaid   bool              `json:"is_fully_paid,omitempty"`  // true if all the installments have been paid.
+	Currency      Currency          `json:"currency,omitempty"`       // Currency code (three-letter ISO 4217) of the installments.
+	CreatedAt     Timestamp         `json:"created_at,omitempty"`     // Creation date.
+	Schedule      []ScheduleItem    `json:"schedule,omitempty"`       // The installments.
+	Billing       Billing           `json:"billing,omitempty"`        // Information about billing.
+	Shipping      Shipping          `json:"shipping,omitempty"`       // Information about shipping.
+	HostedPayment HostedPayment     `json:"hosted_payment,omitempty"` // Information about the payment page.
+	Failure       OptionnalFailure  `json:"failure,omitempty"`        // Information for unsuccessful installment plans.
+	Notification  NotificationState `json:"notification,omitempty"`   // Data related to notifications
+	Metadata      Metadata          `json:"metadata,omitempty"`       // Custom metadata object added when creating the installment plan.
+
+	Raw *RawJSON `json:"-"` // The JSON the object was decoded from, with its unknown fields
 }
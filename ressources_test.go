@@ -27,8 +27,7 @@ func TestJSON(t *testing.T) {
 	}
 }
 
-func TestPayment(t *testing.T) {
-	jsonIn := `
+const paymentFixture = `
 	{
 		"id": "pay_5iHMDxy4ABR4YBVW4UscIn",
 		"object": "payment",
@@ -102,8 +101,10 @@ func TestPayment(t *testing.T) {
 		  "customer_id": 42
 		}
 	  }`
+
+func TestPayment(t *testing.T) {
 	var p Payment
-	if err := json.Unmarshal([]byte(jsonIn), &p); err != nil {
+	if err := json.Unmarshal([]byte(paymentFixture), &p); err != nil {
 		t.Fatal(err)
 	}
 }
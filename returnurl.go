@@ -0,0 +1,180 @@
+package payplug
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// query parameters added to the signed URLs
+const (
+	returnOrderParam     = "pp_order"
+	returnPaymentParam   = "pp_payment"
+	returnExpiresParam   = "pp_expires"
+	returnKindParam      = "pp_kind"
+	returnSignatureParam = "pp_signature"
+)
+
+var (
+	// ErrInvalidSignature is returned when a return URL has been forged or altered.
+	ErrInvalidSignature = errors.New("invalid return URL signature")
+	// ErrExpiredURL is returned when a return URL is used after its expiry.
+	ErrExpiredURL = errors.New("return URL has expired")
+)
+
+// DefaultReturnTTL is the validity of the URLs built by SetURLs
+// when ReturnSigner.TTL is not set.
+const DefaultReturnTTL = 24 * time.Hour
+
+// ReturnKind distinguishes the return and cancel URLs, so that
+// one may not be used as the other.
+type ReturnKind string
+
+const (
+	ReturnPage ReturnKind = "return"
+	CancelPage ReturnKind = "cancel"
+)
+
+// ReturnPayload is the signed content of a return or cancel URL.
+type ReturnPayload struct {
+	Kind      ReturnKind
+	OrderId   string
+	PaymentId string // may be empty, see ReturnHandler.Lookup
+	ExpiresAt time.Time
+}
+
+// ReturnSigner builds and verifies return and cancel URLs
+// signed with HMAC-SHA256.
+type ReturnSigner struct {
+	Key []byte        // Secret key used to sign, distinct from the PayPlug secret key
+	TTL time.Duration // Validity of the URLs built by SetURLs, default to DefaultReturnTTL
+}
+
+func (r ReturnSigner) signature(p ReturnPayload) string {
+	mac := hmac.New(sha256.New, r.Key)
+	fmt.Fprintf(mac, "%s=%s&%s=%s&%s=%s&%s=%d",
+		returnKindParam, url.QueryEscape(string(p.Kind)),
+		returnOrderParam, url.QueryEscape(p.OrderId),
+		returnPaymentParam, url.QueryEscape(p.PaymentId),
+		returnExpiresParam, p.ExpiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignURL adds the signed `payload` to the query of `base`.
+func (r ReturnSigner) SignURL(base string, payload ReturnPayload) (string, error) {
+	if len(r.Key) == 0 {
+		return "", errors.New("missing signing key")
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	if payload.Kind != ReturnPage && payload.Kind != CancelPage {
+		return "", fmt.Errorf("invalid return URL kind %q", payload.Kind)
+	}
+	q := u.Query()
+	q.Set(returnKindParam, string(payload.Kind))
+	q.Set(returnOrderParam, payload.OrderId)
+	if payload.PaymentId != "" {
+		q.Set(returnPaymentParam, payload.PaymentId)
+	}
+	q.Set(returnExpiresParam, strconv.FormatInt(payload.ExpiresAt.Unix(), 10))
+	q.Set(returnSignatureParam, r.signature(payload))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// SetURLs sets the return and cancel URLs of `p`, signing `orderId`.
+// Since the payment ID is only known once the payment is created,
+// it is not part of the payload: ReturnHandler.Lookup must then be provided.
+func (r ReturnSigner) SetURLs(p *Payment, returnBase, cancelBase, orderId string) (err error) {
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = DefaultReturnTTL
+	}
+	payload := ReturnPayload{Kind: ReturnPage, OrderId: orderId, ExpiresAt: time.Now().Add(ttl)}
+	p.HostedPayment.ReturnUrl, err = r.SignURL(returnBase, payload)
+	if err != nil {
+		return err
+	}
+	payload.Kind = CancelPage
+	p.HostedPayment.CancelUrl, err = r.SignURL(cancelBase, payload)
+	return err
+}
+
+// Verify checks the signature and expiry of `u`, and returns its payload.
+// The caller must check the kind of the payload.
+func (r ReturnSigner) Verify(u *url.URL) (ReturnPayload, error) {
+	q := u.Query()
+	exp, err := strconv.ParseInt(q.Get(returnExpiresParam), 10, 64)
+	if err != nil {
+		return ReturnPayload{}, ErrInvalidSignature
+	}
+	payload := ReturnPayload{
+		Kind:      ReturnKind(q.Get(returnKindParam)),
+		OrderId:   q.Get(returnOrderParam),
+		PaymentId: q.Get(returnPaymentParam),
+		ExpiresAt: time.Unix(exp, 0),
+	}
+	if !hmac.Equal([]byte(q.Get(returnSignatureParam)), []byte(r.signature(payload))) {
+		return ReturnPayload{}, ErrInvalidSignature
+	}
+	if time.Now().After(payload.ExpiresAt) {
+		return ReturnPayload{}, ErrExpiredURL
+	}
+	return payload, nil
+}
+
+// ReturnHandler serves the return and cancel pages of hosted payments.
+// It verifies the signature of the URL, and re-fetches the payment
+// from PayPlug before calling `Callback`, so that query strings
+// are never trusted.
+type ReturnHandler struct {
+	Session Session
+	Signer  ReturnSigner
+	Kind    ReturnKind // The page served, the URLs of the other kind are rejected
+
+	// Lookup returns the ID of the payment of an order, and is used
+	// when the URL was signed without payment ID. It may be nil otherwise.
+	Lookup func(orderId string) (paymentId string, err error)
+
+	// Callback is called with the trusted payment, and must write the response.
+	Callback func(w http.ResponseWriter, r *http.Request, orderId string, payment Payment, status Status)
+}
+
+func (h ReturnHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload, err := h.Signer.Verify(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if payload.Kind != h.Kind {
+		http.Error(w, fmt.Sprintf("expected a %s URL, got %q", h.Kind, payload.Kind), http.StatusForbidden)
+		return
+	}
+
+	paymentId := payload.PaymentId
+	if paymentId == "" {
+		if h.Lookup == nil {
+			http.Error(w, "missing payment ID", http.StatusInternalServerError)
+			return
+		}
+		if paymentId, err = h.Lookup(payload.OrderId); err != nil {
+			http.Error(w, fmt.Sprintf("unknown order %q: %s", payload.OrderId, err), http.StatusNotFound)
+			return
+		}
+	}
+
+	payment, err := h.Session.GetPayment(paymentId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	h.Callback(w, r, payload.OrderId, payment, payment.Status())
+}
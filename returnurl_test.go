@@ -0,0 +1,98 @@
+package payplug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestReturnSigner(t *testing.T) {
+	signer := ReturnSigner{Key: []byte("secret"), TTL: time.Hour}
+	var p Payment
+	if err := signer.SetURLs(&p, "https://example.net/success?lang=fr", "https://example.net/cancel", "42"); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(p.HostedPayment.ReturnUrl)
+	payload, err := signer.Verify(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.OrderId != "42" || payload.Kind != ReturnPage || u.Query().Get("lang") != "fr" {
+		t.Fatalf("unexpected payload %v for %s", payload, u)
+	}
+
+	forged := u.Query()
+	forged.Set(returnOrderParam, "43")
+	u.RawQuery = forged.Encode()
+	if _, err = signer.Verify(u); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+
+	// the kind is signed
+	u, _ = url.Parse(p.HostedPayment.CancelUrl)
+	replayed := u.Query()
+	replayed.Set(returnKindParam, string(ReturnPage))
+	u.RawQuery = replayed.Encode()
+	if _, err = signer.Verify(u); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+
+	// the zero TTL uses the default
+	if err := (ReturnSigner{Key: []byte("secret")}).SetURLs(&p, "https://example.net/success", "https://example.net/cancel", "42"); err != nil {
+		t.Fatal(err)
+	}
+	u, _ = url.Parse(p.HostedPayment.ReturnUrl)
+	if _, err = signer.Verify(u); err != nil {
+		t.Fatal(err)
+	}
+
+	expired, _ := signer.SignURL("https://example.net/success", ReturnPayload{Kind: ReturnPage, OrderId: "42", ExpiresAt: time.Now().Add(-time.Minute)})
+	u, _ = url.Parse(expired)
+	if _, err = signer.Verify(u); err != ErrExpiredURL {
+		t.Fatalf("expected ErrExpiredURL, got %v", err)
+	}
+}
+
+func TestReturnHandler(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Payment{Id: "pay_1", IsPaid: true})
+	}))
+	defer api.Close()
+
+	session := NewSession("sk_test")
+	session.SetBaseUrl(api.URL)
+	signer := ReturnSigner{Key: []byte("secret"), TTL: time.Hour}
+	var gotStatus Status
+	handler := ReturnHandler{
+		Session: session,
+		Signer:  signer,
+		Kind:    ReturnPage,
+		Lookup:  func(orderId string) (string, error) { return "pay_" + orderId, nil },
+		Callback: func(w http.ResponseWriter, r *http.Request, orderId string, payment Payment, status Status) {
+			gotStatus = status
+		},
+	}
+
+	var p Payment
+	signer.SetURLs(&p, "https://example.net/success", "https://example.net/cancel", "1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p.HostedPayment.ReturnUrl, nil))
+	if rec.Code != http.StatusOK || gotStatus != StatusPaid {
+		t.Fatalf("unexpected response %d, status %s", rec.Code, gotStatus)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p.HostedPayment.CancelUrl, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected forbidden for the cancel URL, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://example.net/success?pp_order=1", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected forbidden, got %d", rec.Code)
+	}
+}
@@ -2,7 +2,6 @@ package payplug
 
 import (
 	"fmt"
-	"path"
 )
 
 // API base url
@@ -19,17 +18,26 @@ const (
 	CUSTOMER_RESOURCE          = baseUrl + "/customers"
 	CARD_RESOURCE              = CUSTOMER_RESOURCE + "/%s/cards" // customer id
 	ACCOUNTING_REPORT_RESOURCE = baseUrl + "/accounting_reports"
+	INSTALLMENT_PLAN_RESOURCE  = baseUrl + "/installment_plans"
+	OAUTH2_TOKEN_RESOURCE      = API_BASE_URL + "/oauth2/token"
 )
 
+// path.Join must not be used here, since it would
+// collapse the double slash of the scheme.
+
 func (p *Payment) urlForConsistent() string {
-	return path.Join(PAYMENT_RESOURCE, p.Id)
+	return PAYMENT_RESOURCE + "/" + p.Id
 }
 
 func (r *Refund) urlForConsistent() string {
 	u := fmt.Sprintf(REFUND_RESOURCE, r.PaymentId)
-	return path.Join(u, r.Id)
+	return u + "/" + r.Id
 }
 
 func (a *AccountingReport) urlForConsistent() string {
-	return path.Join(ACCOUNTING_REPORT_RESOURCE, a.Id)
+	return ACCOUNTING_REPORT_RESOURCE + "/" + a.Id
+}
+
+func (i *InstallmentPlan) urlForConsistent() string {
+	return INSTALLMENT_PLAN_RESOURCE + "/" + i.Id
 }
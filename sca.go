@@ -0,0 +1,92 @@
+package payplug
+
+import (
+	"strings"
+)
+
+// Initiator tells who triggers a payment, which decides
+// whether Strong Customer Authentication applies.
+type Initiator string
+
+const (
+	// The customer is present and may be authenticated (checkout).
+	InitiatorPayer Initiator = "PAYER"
+	// The merchant charges a saved card without the customer
+	// (recurring or deferred charges). 3-D Secure is not possible.
+	InitiatorMerchant Initiator = "MERCHANT"
+)
+
+// ScaExemption requests an exemption from Strong Customer Authentication,
+// for customer-initiated payments. The issuer may still require 3-D Secure.
+type ScaExemption string
+
+const (
+	ExemptionLowValue                ScaExemption = "low_value"                 // Payments under 30 EUR
+	ExemptionTransactionRiskAnalysis ScaExemption = "transaction_risk_analysis" // Low risk payments, as assessed by the acquirer
+)
+
+// savedCardPrefix is the prefix of the IDs of saved cards
+const savedCardPrefix = "card_"
+
+// SavedCard returns the payment method charging the saved card `cardId`.
+func SavedCard(cardId string) PaymentMethod {
+	return PaymentMethod{Type: MethodType(cardId)}
+}
+
+// IsSavedCard returns true if `m` is the ID of a saved card.
+func (m MethodType) IsSavedCard() bool {
+	return strings.HasPrefix(string(m), savedCardPrefix)
+}
+
+// SetInitiator sets the initiator and SCA fields of `p`:
+//   - for InitiatorMerchant, the saved card `cardId` is charged without 3-D Secure,
+//     and `cardId` is required
+//   - for InitiatorPayer, the customer pays on the hosted page, with the
+//     saved card `cardId` if not empty (one-click), and PayPlug decides on 3-D Secure.
+//
+// Fields set by a previous call are reset.
+func (p *Payment) SetInitiator(initiator Initiator, cardId string) error {
+	p.Initiator = initiator
+	p.Force3ds = nil
+	p.ScaExemption = ""
+	p.PaymentMethod = PaymentMethod{}
+	if cardId != "" {
+		p.PaymentMethod = SavedCard(cardId)
+	}
+	switch initiator {
+	case InitiatorMerchant:
+		if cardId == "" {
+			return ValidationError{Field: "initiator", Reason: "merchant-initiated payments require a saved card"}
+		}
+		noForce := false
+		p.Force3ds = &noForce
+		p.SaveCard, p.AllowSaveCard = false, false
+	case InitiatorPayer:
+	default:
+		return ValidationError{Field: "initiator", Reason: "expected PAYER or MERCHANT"}
+	}
+	return nil
+}
+
+// validateSca checks the consistency of the initiator and SCA fields.
+func validateSca(p Payment) error {
+	switch p.Initiator {
+	case "", InitiatorPayer:
+	case InitiatorMerchant:
+		if !p.PaymentMethod.Type.IsSavedCard() {
+			return ValidationError{Field: "initiator", Reason: "merchant-initiated payments require a saved card"}
+		}
+		if p.Force3ds != nil && *p.Force3ds {
+			return ValidationError{Field: "force_3ds", Reason: "3-D Secure is not possible without the payer"}
+		}
+		if p.ScaExemption != "" {
+			return ValidationError{Field: "sca_exemption", Reason: "exemptions only apply to payer-initiated payments"}
+		}
+		if p.SaveCard || p.AllowSaveCard {
+			return ValidationError{Field: "save_card", Reason: "the card is already saved"}
+		}
+	default:
+		return ValidationError{Field: "initiator", Reason: "expected PAYER or MERCHANT"}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package payplug
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSetInitiator(t *testing.T) {
+	p := Payment{Amount: 1000, Currency: Eur, SaveCard: true}
+	if err := p.SetInitiator(InitiatorMerchant, ""); err == nil {
+		t.Fatal("expected error for missing card")
+	}
+	if err := p.SetInitiator(InitiatorMerchant, "card_1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateSca(p); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(b, &fields)
+	if fields["initiator"] != "MERCHANT" || fields["payment_method"] != "card_1" || fields["force_3ds"] != false {
+		t.Fatalf("unexpected body %s", b)
+	}
+
+	if err := p.SetInitiator(InitiatorPayer, ""); err != nil {
+		t.Fatal(err)
+	}
+	if p.Force3ds != nil || p.PaymentMethod.Type != MethodCard {
+		t.Fatalf("unexpected payment %+v", p)
+	}
+
+	force := true
+	p = Payment{Initiator: InitiatorMerchant, PaymentMethod: SavedCard("card_1"), Force3ds: &force}
+	if err := validateSca(p); err == nil {
+		t.Fatal("expected error for 3DS on merchant-initiated payment")
+	}
+}
@@ -0,0 +1,49 @@
+package payplug
+
+// Status summarizes the state of a payment.
+type Status uint8
+
+const (
+	StatusPending    Status = iota // Not paid yet, and not failed
+	StatusAuthorized               // Deferred payment, authorized but not captured yet
+	StatusPaid                     // Paid, and not fully refunded
+	StatusRefunded                 // Paid, then fully refunded
+	StatusFailed                   // Failed, aborted or timed out (see Failure)
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusAuthorized:
+		return "authorized"
+	case StatusPaid:
+		return "paid"
+	case StatusRefunded:
+		return "refunded"
+	case StatusFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// IsFinal returns true if the status will not change anymore,
+// except for refunds.
+func (s Status) IsFinal() bool {
+	return s == StatusPaid || s == StatusRefunded || s == StatusFailed
+}
+
+// Status returns the current status of the payment.
+func (p Payment) Status() Status {
+	switch {
+	case p.IsRefunded:
+		return StatusRefunded
+	case p.IsPaid:
+		return StatusPaid
+	case p.Failure.Valid:
+		return StatusFailed
+	case p.Authorization.Valid && p.Authorization.Authorization.AuthorizedAt != 0:
+		return StatusAuthorized
+	}
+	return StatusPending
+}
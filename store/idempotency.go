@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+// SQLIdempotency is a payplug.IdempotencyStore sharing the database of a SQL store,
+// so that idempotent calls are protected across processes.
+type SQLIdempotency struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var _ payplug.IdempotencyStore = (*SQLIdempotency)(nil)
+
+// Idempotency returns the idempotency store using the
+// database of `s`. Migrate must have been called.
+func (s *SQL) Idempotency() *SQLIdempotency {
+	return &SQLIdempotency{db: s.db, dialect: s.dialect}
+}
+
+func (s *SQLIdempotency) load(ctx context.Context, key string) (payplug.IdempotencyRecord, error) {
+	var (
+		r        payplug.IdempotencyRecord
+		response sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx, s.dialect.query(`SELECT started_at, claimed_at, attempts, response
+		FROM payplug_idempotency WHERE idempotency_key = ?`), key).Scan(&r.StartedAt, &r.ClaimedAt, &r.Attempts, &response)
+	if response.Valid {
+		r.Response = json.RawMessage(response.String)
+	}
+	return r, err
+}
+
+// Claim inserts the record, or takes over a claimable one, in a single
+// statement, so that concurrent claims can't both succeed.
+func (s *SQLIdempotency) Claim(key string, lease time.Duration) (payplug.IdempotencyRecord, bool, error) {
+	ctx := context.Background()
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, s.dialect.query(`INSERT INTO payplug_idempotency
+		(idempotency_key, started_at, claimed_at, attempts, response) VALUES (?, ?, ?, 1, NULL)
+		ON CONFLICT (idempotency_key) DO UPDATE
+		SET claimed_at = excluded.claimed_at, attempts = payplug_idempotency.attempts + 1
+		WHERE payplug_idempotency.response IS NULL AND payplug_idempotency.claimed_at < ?`),
+		key, now.Unix(), now.Unix(), now.Add(-lease).Unix())
+	if err != nil {
+		return payplug.IdempotencyRecord{}, false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return payplug.IdempotencyRecord{}, false, err
+	}
+	r, err := s.load(ctx, key)
+	return r, n == 1, err
+}
+
+// Save only updates the record if it is still owned by the attempt
+// `record.Attempts`, which Claim increments atomically.
+func (s *SQLIdempotency) Save(key string, record payplug.IdempotencyRecord) error {
+	var response sql.NullString
+	if record.Response != nil {
+		response = sql.NullString{String: string(record.Response), Valid: true}
+	}
+	res, err := s.db.Exec(s.dialect.query(`UPDATE payplug_idempotency
+		SET claimed_at = ?, response = ?
+		WHERE idempotency_key = ? AND attempts = ? AND response IS NULL`),
+		record.ClaimedAt, response, key, record.Attempts)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return payplug.ErrIdempotencyClaimLost
+	}
+	return nil
+}
+
+func (s *SQLIdempotency) Release(key string) error {
+	_, err := s.db.Exec(s.dialect.query(`DELETE FROM payplug_idempotency WHERE idempotency_key = ?`), key)
+	return err
+}
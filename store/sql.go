@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Dialect adapts the SQL statements to a database engine.
+type Dialect struct {
+	Name string
+
+	// placeholder returns the n-th (starting at 1) query parameter
+	placeholder func(n int) string
+	// begin starts the transactions of Save
+	begin string
+	// migrations are applied in order, and never modified once published
+	migrations []string
+}
+
+var (
+	// SQLite is the dialect for SQLite 3. Since concurrent saves wait
+	// for the database lock, a busy timeout should be configured.
+	SQLite = Dialect{
+		Name:        "sqlite",
+		placeholder: func(int) string { return "?" },
+		// take the write lock at once, so that concurrent saves are serialized
+		// instead of failing when upgrading their read lock
+		begin: "BEGIN IMMEDIATE",
+		migrations: []string{
+			`CREATE TABLE payplug_snapshots (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				kind TEXT NOT NULL,
+				object_id TEXT NOT NULL,
+				version INTEGER NOT NULL,
+				recorded_at INTEGER NOT NULL,
+				hash TEXT NOT NULL,
+				data TEXT NOT NULL,
+				UNIQUE (kind, object_id, version)
+			)`,
+			`CREATE TABLE payplug_idempotency (
+				idempotency_key TEXT PRIMARY KEY,
+				started_at INTEGER NOT NULL,
+				claimed_at INTEGER NOT NULL,
+				attempts INTEGER NOT NULL,
+				response TEXT
+			)`,
+		},
+	}
+
+	// PostgreSQL is the dialect for PostgreSQL 10 and later.
+	PostgreSQL = Dialect{
+		Name:        "postgres",
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+		begin:       "BEGIN",
+		migrations: []string{
+			`CREATE TABLE payplug_snapshots (
+				id BIGSERIAL PRIMARY KEY,
+				kind TEXT NOT NULL,
+				object_id TEXT NOT NULL,
+				version INTEGER NOT NULL,
+				recorded_at BIGINT NOT NULL,
+				hash TEXT NOT NULL,
+				data JSONB NOT NULL,
+				UNIQUE (kind, object_id, version)
+			)`,
+			`CREATE TABLE payplug_idempotency (
+				idempotency_key TEXT PRIMARY KEY,
+				started_at BIGINT NOT NULL,
+				claimed_at BIGINT NOT NULL,
+				attempts INTEGER NOT NULL,
+				response TEXT
+			)`,
+		},
+	}
+)
+
+// query replaces the `?` of `q` by the dialect placeholders
+func (d Dialect) query(q string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString(d.placeholder(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// SQL is a Store backed by a database/sql connection.
+// The driver must be registered by the caller.
+type SQL struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewSQL returns a Store using `db`. Migrate must be called
+// before using it.
+func NewSQL(db *sql.DB, dialect Dialect) *SQL {
+	return &SQL{db: db, dialect: dialect}
+}
+
+// Migrate creates or updates the tables used by the store.
+// It is safe to call it on every start.
+func (s *SQL) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS payplug_schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return fmt.Errorf("store: creating migrations table: %s", err)
+	}
+	var current int
+	err = s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM payplug_schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("store: reading schema version: %s", err)
+	}
+	for i := current; i < len(s.dialect.migrations); i++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, s.dialect.migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("store: migration %d: %s", i+1, err)
+		}
+		if _, err = tx.ExecContext(ctx, s.dialect.query(`INSERT INTO payplug_schema_migrations (version) VALUES (?)`), i+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("store: migration %d: %s", i+1, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("store: migration %d: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
+// saveAttempts bounds the retries of Save when concurrent
+// saves of the same object conflict
+const saveAttempts = 5
+
+// Save stores `snap` as a new version, unless the latest version is identical.
+// Concurrent saves of the same object picking the same version are retried.
+func (s *SQL) Save(ctx context.Context, snap Snapshot) error {
+	for attempt := 1; ; attempt++ {
+		version, err := s.save(ctx, snap)
+		if err == nil || attempt == saveAttempts {
+			return err
+		}
+		if taken, errTaken := s.versionExists(ctx, snap, version); errTaken != nil || !taken {
+			return err // not a conflict
+		}
+	}
+}
+
+// save inserts `snap` and returns the version it tried to insert
+func (s *SQL) save(ctx context.Context, snap Snapshot) (version int, err error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	// the transaction is handled manually to use the dialect begin statement
+	if _, err = conn.ExecContext(ctx, s.dialect.begin); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			conn.ExecContext(context.Background(), "ROLLBACK")
+		}
+	}()
+
+	var hash string
+	err = conn.QueryRowContext(ctx, s.dialect.query(`SELECT version, hash FROM payplug_snapshots
+		WHERE kind = ? AND object_id = ? ORDER BY version DESC LIMIT 1`), snap.Kind, snap.Id).Scan(&version, &hash)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	newHash := snap.hash()
+	if hash == newHash {
+		_, err = conn.ExecContext(ctx, "COMMIT")
+		return version, err
+	}
+	version++
+	_, err = conn.ExecContext(ctx, s.dialect.query(`INSERT INTO payplug_snapshots
+		(kind, object_id, version, recorded_at, hash, data) VALUES (?, ?, ?, ?, ?, ?)`),
+		snap.Kind, snap.Id, version, time.Now().Unix(), newHash, string(snap.Data))
+	if err != nil {
+		return version, err
+	}
+	_, err = conn.ExecContext(ctx, "COMMIT")
+	return version, err
+}
+
+// versionExists returns true if `version` of the object of `snap` is stored
+func (s *SQL) versionExists(ctx context.Context, snap Snapshot, version int) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, s.dialect.query(`SELECT COUNT(*) FROM payplug_snapshots
+		WHERE kind = ? AND object_id = ? AND version = ?`), snap.Kind, snap.Id, version).Scan(&n)
+	return n > 0, err
+}
+
+func (s *SQL) selectSnapshots(ctx context.Context, kind Kind, id string, suffix string) ([]Snapshot, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.query(`SELECT version, recorded_at, data FROM payplug_snapshots
+		WHERE kind = ? AND object_id = ? `+suffix), kind, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Snapshot
+	for rows.Next() {
+		var (
+			snap       = Snapshot{Kind: kind, Id: id}
+			recordedAt int64
+			data       string
+		)
+		if err := rows.Scan(&snap.Version, &recordedAt, &data); err != nil {
+			return nil, err
+		}
+		snap.RecordedAt = time.Unix(recordedAt, 0)
+		snap.Data = []byte(data)
+		out = append(out, snap)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQL) Latest(ctx context.Context, kind Kind, id string) (Snapshot, error) {
+	l, err := s.selectSnapshots(ctx, kind, id, "ORDER BY version DESC LIMIT 1")
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(l) == 0 {
+		return Snapshot{}, ErrNotFound
+	}
+	return l[0], nil
+}
+
+func (s *SQL) History(ctx context.Context, kind Kind, id string) ([]Snapshot, error) {
+	return s.selectSnapshots(ctx, kind, id, "ORDER BY version")
+}
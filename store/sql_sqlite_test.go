@@ -0,0 +1,155 @@
+//go:build sqlite
+
+// The SQL tests require the modernc.org/sqlite driver:
+//
+//	go test -tags sqlite ./store/
+
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+	_ "modernc.org/sqlite"
+)
+
+func openSQLite(t *testing.T) *SQL {
+	t.Helper()
+	return openSQLiteFile(t, filepath.Join(t.TempDir(), "test.db"))
+}
+
+func openSQLiteFile(t *testing.T, path string) *SQL {
+	t.Helper()
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := NewSQL(db, SQLite)
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSQLIdempotency(t *testing.T) {
+	st := openSQLite(t).Idempotency()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed int
+	)
+	for range [10]int{} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := st.Claim("k", time.Minute)
+			if err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				claimed++
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != 1 {
+		t.Fatalf("expected a single claim, got %d", claimed)
+	}
+
+	// a running attempt is taken over once its lease expired
+	r, ok, err := st.Claim("k", -time.Minute)
+	if err != nil || !ok || r.Attempts != 2 {
+		t.Fatalf("expected a second attempt, got %v %+v %v", ok, r, err)
+	}
+
+	// the first attempt lost its claim
+	lost := r
+	lost.Attempts, lost.ClaimedAt, lost.Response = 1, 0, json.RawMessage(`{"id":"pay_0"}`)
+	if err := st.Save("k", lost); err != payplug.ErrIdempotencyClaimLost {
+		t.Fatalf("expected lost claim, got %v", err)
+	}
+
+	r.ClaimedAt, r.Response = 0, json.RawMessage(`{"id":"pay_1"}`)
+	if err := st.Save("k", r); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Save("k", r); err != payplug.ErrIdempotencyClaimLost {
+		t.Fatalf("a saved response should not be replaced, got %v", err)
+	}
+	r, ok, err = st.Claim("k", -time.Minute)
+	if err != nil || ok || string(r.Response) != `{"id":"pay_1"}` {
+		t.Fatalf("a finished call should not be claimed, got %v %+v %v", ok, r, err)
+	}
+
+	if err := st.Release("k"); err != nil {
+		t.Fatal(err)
+	}
+	if r, ok, err := st.Claim("k", time.Minute); err != nil || !ok || r.Attempts != 1 || r.Response != nil {
+		t.Fatalf("expected a new record, got %v %+v %v", ok, r, err)
+	}
+}
+
+func TestSQL(t *testing.T) { testStore(t, openSQLite(t)) }
+
+func TestSQLMigrate(t *testing.T) {
+	s := openSQLite(t)
+	if err := s.Migrate(context.Background()); err != nil { // already applied
+		t.Fatal(err)
+	}
+	var version int
+	if err := s.db.QueryRow(`SELECT MAX(version) FROM payplug_schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(SQLite.migrations) || len(SQLite.migrations) != len(PostgreSQL.migrations) {
+		t.Fatalf("unexpected schema version %d", version)
+	}
+}
+
+func TestSQLConcurrentSave(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	s := openSQLiteFile(t, path)
+	other := openSQLiteFile(t, path) // as an other process would do
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			st := s
+			if i%2 == 0 {
+				st = other
+			}
+			snap := Snapshot{Kind: KindPayment, Id: "pay_1", Data: []byte(fmt.Sprintf(`{"id":"pay_1","amount":%d}`, i))}
+			if err := st.Save(ctx, snap); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	history, err := s.History(ctx, KindPayment, "pay_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != n {
+		t.Fatalf("expected %d versions, got %d", n, len(history))
+	}
+	for i, snap := range history {
+		if snap.Version != i+1 {
+			t.Fatalf("unexpected version %d at %d", snap.Version, i)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package store persists snapshots of PayPlug objects, keeping
+// their history.
+//
+// Objects are stored as their JSON representation, so that
+// the Optionnal* types of the payplug package are handled
+// without any custom mapping.
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+// ErrNotFound is returned when no snapshot exists for an object.
+var ErrNotFound = errors.New("store: object not found")
+
+// Kind identifies the type of a stored object.
+type Kind string
+
+const (
+	KindPayment         Kind = "payment"
+	KindRefund          Kind = "refund"
+	KindCustomer        Kind = "customer"
+	KindInstallmentPlan Kind = "installment_plan"
+)
+
+// Snapshot is the state of an object at a given time.
+type Snapshot struct {
+	Kind       Kind
+	Id         string
+	Version    int       // starting at 1, incremented on each change
+	RecordedAt time.Time // when the snapshot was saved
+	Data       json.RawMessage
+}
+
+// hash is used to detect unchanged objects.
+func (s Snapshot) hash() string {
+	h := sha256.Sum256(s.Data)
+	return hex.EncodeToString(h[:])
+}
+
+// Store persists the snapshots of PayPlug objects.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Save records `s` as a new version of the object, unless its data
+	// is identical to the latest version.
+	// `Version` and `RecordedAt` are set by the store.
+	Save(ctx context.Context, s Snapshot) error
+
+	// Latest returns the most recent snapshot of the object,
+	// or ErrNotFound.
+	Latest(ctx context.Context, kind Kind, id string) (Snapshot, error)
+
+	// History returns all the snapshots of the object, oldest first.
+	History(ctx context.Context, kind Kind, id string) ([]Snapshot, error)
+}
+
+func save(ctx context.Context, st Store, kind Kind, id string, v interface{}) error {
+	if id == "" {
+		return fmt.Errorf("store: missing %s id", kind)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return st.Save(ctx, Snapshot{Kind: kind, Id: id, Data: data})
+}
+
+func load(ctx context.Context, st Store, kind Kind, id string, out interface{}) error {
+	s, err := st.Latest(ctx, kind, id)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(s.Data, out)
+}
+
+// SavePayment records the current state of `p`.
+func SavePayment(ctx context.Context, st Store, p payplug.Payment) error {
+	return save(ctx, st, KindPayment, p.Id, p)
+}
+
+// LoadPayment returns the latest saved state of the payment `id`.
+func LoadPayment(ctx context.Context, st Store, id string) (payplug.Payment, error) {
+	var out payplug.Payment
+	err := load(ctx, st, KindPayment, id, &out)
+	return out, err
+}
+
+// SaveRefund records the current state of `r`.
+// Refund IDs are unique, so the payment ID is not part of the key.
+func SaveRefund(ctx context.Context, st Store, r payplug.Refund) error {
+	return save(ctx, st, KindRefund, r.Id, r)
+}
+
+// LoadRefund returns the latest saved state of the refund `id`.
+func LoadRefund(ctx context.Context, st Store, id string) (payplug.Refund, error) {
+	var out payplug.Refund
+	err := load(ctx, st, KindRefund, id, &out)
+	return out, err
+}
+
+// SaveCustomer records the current state of `c`.
+func SaveCustomer(ctx context.Context, st Store, c payplug.Customer) error {
+	return save(ctx, st, KindCustomer, c.Id, c)
+}
+
+// LoadCustomer returns the latest saved state of the customer `id`.
+func LoadCustomer(ctx context.Context, st Store, id string) (payplug.Customer, error) {
+	var out payplug.Customer
+	err := load(ctx, st, KindCustomer, id, &out)
+	return out, err
+}
+
+// SaveInstallmentPlan records the current state of `i`.
+func SaveInstallmentPlan(ctx context.Context, st Store, i payplug.InstallmentPlan) error {
+	return save(ctx, st, KindInstallmentPlan, i.Id, i)
+}
+
+// LoadInstallmentPlan returns the latest saved state of the installment plan `id`.
+func LoadInstallmentPlan(ctx context.Context, st Store, id string) (payplug.InstallmentPlan, error) {
+	var out payplug.InstallmentPlan
+	err := load(ctx, st, KindInstallmentPlan, id, &out)
+	return out, err
+}
+
+// SavePaymentList records every payment of `list`.
+func SavePaymentList(ctx context.Context, st Store, list payplug.PaymentList) error {
+	for _, p := range list.Data {
+		if err := SavePayment(ctx, st, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveRefundList records every refund of `list`.
+func SaveRefundList(ctx context.Context, st Store, list payplug.RefundList) error {
+	for _, r := range list.Data {
+		if err := SaveRefund(ctx, st, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveCustomerList records every customer of `list`.
+func SaveCustomerList(ctx context.Context, st Store, list payplug.CustomerList) error {
+	for _, c := range list.Data {
+		if err := SaveCustomer(ctx, st, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleNotificationPayment calls Session.HandleNotificationPayment
+// and saves the trusted payment.
+func HandleNotificationPayment(ctx context.Context, st Store, s payplug.Session, body io.Reader) (payplug.Payment, error) {
+	p, err := s.HandleNotificationPayment(body)
+	if err != nil {
+		return p, err
+	}
+	return p, SavePayment(ctx, st, p)
+}
+
+// HandleNotificationRefund calls Session.HandleNotificationRefund
+// and saves the trusted refund.
+func HandleNotificationRefund(ctx context.Context, st Store, s payplug.Session, body io.Reader) (payplug.Refund, error) {
+	r, err := s.HandleNotificationRefund(body)
+	if err != nil {
+		return r, err
+	}
+	return r, SaveRefund(ctx, st, r)
+}
+
+// HandleNotificationInstallmentPlan calls Session.HandleNotificationInstallmentPlan
+// and saves the trusted installment plan.
+func HandleNotificationInstallmentPlan(ctx context.Context, st Store, s payplug.Session, body io.Reader) (payplug.InstallmentPlan, error) {
+	i, err := s.HandleNotificationInstallmentPlan(body)
+	if err != nil {
+		return i, err
+	}
+	return i, SaveInstallmentPlan(ctx, st, i)
+}
+
+type key struct {
+	kind Kind
+	id   string
+}
+
+// Memory is an in-memory Store, mainly useful for tests.
+// The zero value is ready to use.
+type Memory struct {
+	mu        sync.Mutex
+	snapshots map[key][]Snapshot
+}
+
+func (m *Memory) Save(_ context.Context, s Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.snapshots == nil {
+		m.snapshots = make(map[key][]Snapshot)
+	}
+	k := key{s.Kind, s.Id}
+	history := m.snapshots[k]
+	if L := len(history); L != 0 && history[L-1].hash() == s.hash() {
+		return nil
+	}
+	s.Version = len(history) + 1
+	s.RecordedAt = time.Now()
+	s.Data = append(json.RawMessage(nil), s.Data...)
+	m.snapshots[k] = append(history, s)
+	return nil
+}
+
+func (m *Memory) Latest(_ context.Context, kind Kind, id string) (Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history := m.snapshots[key{kind, id}]
+	if len(history) == 0 {
+		return Snapshot{}, ErrNotFound
+	}
+	return history[len(history)-1], nil
+}
+
+func (m *Memory) History(_ context.Context, kind Kind, id string) ([]Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Snapshot(nil), m.snapshots[key{kind, id}]...), nil
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+func TestMemory(t *testing.T) { testStore(t, new(Memory)) }
+
+// testStore runs the common tests of the Store implementations
+func testStore(t *testing.T, st Store) {
+	ctx := context.Background()
+
+	if _, err := LoadPayment(ctx, st, "pay_1"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	p := payplug.Payment{Id: "pay_1", Amount: 1000}
+	if err := SavePayment(ctx, st, p); err != nil {
+		t.Fatal(err)
+	}
+	if err := SavePayment(ctx, st, p); err != nil { // unchanged
+		t.Fatal(err)
+	}
+	p.IsPaid = true
+	p.Failure = payplug.OptionnalFailure{Valid: true, Failure: payplug.Failure{Code: payplug.Timeout}}
+	if err := SavePaymentList(ctx, st, payplug.PaymentList{Data: []payplug.Payment{p}}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := st.History(ctx, KindPayment, "pay_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Version != 1 || history[1].Version != 2 {
+		t.Fatalf("unexpected history %v", history)
+	}
+
+	got, err := LoadPayment(ctx, st, "pay_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.IsPaid || !got.Failure.Valid || got.Failure.Failure.Code != payplug.Timeout {
+		t.Fatalf("unexpected payment %+v", got)
+	}
+
+	if err := SaveRefund(ctx, st, payplug.Refund{}); err == nil {
+		t.Fatal("expected error for missing id")
+	}
+}
+
+func TestDialectQuery(t *testing.T) {
+	q := `SELECT data FROM t WHERE a = ? AND b = ?`
+	if got := PostgreSQL.query(q); got != `SELECT data FROM t WHERE a = $1 AND b = $2` {
+		t.Fatalf("unexpected query %s", got)
+	}
+	if got := SQLite.query(q); got != q {
+		t.Fatalf("unexpected query %s", got)
+	}
+}
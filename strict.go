@@ -0,0 +1,197 @@
+package payplug
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DriftKind is the type of a Drift.
+type DriftKind uint8
+
+const (
+	UnknownField   DriftKind = iota + 1 // The response has a field not modelled by the Go type
+	MissingField                        // The Go type has a field absent from the response
+	ObjectMismatch                      // The "object" field has an unexpected value
+)
+
+func (k DriftKind) String() string {
+	switch k {
+	case UnknownField:
+		return "unknown field"
+	case MissingField:
+		return "missing field"
+	case ObjectMismatch:
+		return "object mismatch"
+	}
+	return fmt.Sprintf("DriftKind(%d)", k)
+}
+
+// Drift is a difference between a response and the Go type it is decoded into.
+type Drift struct {
+	Kind     DriftKind
+	URL      string
+	Type     string // Go type of the decoded object
+	Path     string // Dotted JSON path of the field, such as "card.last4" or "data[0].id"
+	Expected string // For ObjectMismatch
+	Got      string // For ObjectMismatch
+}
+
+func (d Drift) String() string {
+	if d.Kind == ObjectMismatch {
+		return fmt.Sprintf("%s in %s (%s) at %q: expected %q, got %q", d.Kind, d.URL, d.Type, d.Path, d.Expected, d.Got)
+	}
+	return fmt.Sprintf("%s in %s (%s): %q", d.Kind, d.URL, d.Type, d.Path)
+}
+
+// SetStrictDecoding enables the strict mode: each decoded response is
+// compared with its Go type, and the differences are passed to `report`.
+// Requests never fail because of a drift.
+// Passing nil disables the strict mode.
+func (s *Session) SetStrictDecoding(report func(Drift)) {
+	s.onDrift = report
+}
+
+// WithStrictDecoding is the same as Session.SetStrictDecoding.
+func WithStrictDecoding(report func(Drift)) Option {
+	return func(c *config) { c.session.SetStrictDecoding(report) }
+}
+
+// objectNames are the expected values of the "object" field
+var objectNames = map[reflect.Type]string{
+	reflect.TypeOf(Payment{}):          "payment",
+	reflect.TypeOf(Refund{}):           "refund",
+	reflect.TypeOf(AccountingReport{}): "accounting_report",
+	reflect.TypeOf(Customer{}):         "customer",
+	reflect.TypeOf(Card{}):             "card",
+	reflect.TypeOf(InstallmentPlan{}):  "installment_plan",
+	reflect.TypeOf(PaymentList{}):      "list",
+	reflect.TypeOf(RefundList{}):       "list",
+	reflect.TypeOf(CustomerList{}):     "list",
+	reflect.TypeOf(CardList{}):         "list",
+}
+
+// optionalTypes are the types with a custom decoding
+// wrapping an other struct
+var optionalTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(OptionnalAuthorization{}): reflect.TypeOf(Authorization{}),
+	reflect.TypeOf(OptionnalFailure{}):       reflect.TypeOf(Failure{}),
+}
+
+// optionalFields are the fields which may be absent from the responses,
+// because they are only sent at creation, or only returned for some
+// payments. They are never reported as MissingField.
+var optionalFields = map[reflect.Type]map[string]bool{
+	reflect.TypeOf(Payment{}): {
+		"allow_save_card": true, "force_3ds": true, "initiator": true, "notification_url": true,
+		"payment_context": true, "payment_method": true, "sca_exemption": true,
+	},
+	reflect.TypeOf(Billing{}):  {"company_name": true},
+	reflect.TypeOf(Shipping{}): {"company_name": true},
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// jsonFields returns the fields of the struct `t`, by JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	out := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			for n, ft := range jsonFields(f.Type) {
+				out[n] = ft
+			}
+			continue
+		}
+		out[name] = f.Type
+	}
+	return out
+}
+
+// checkDrift compares the JSON `content` with the type `t`.
+func checkDrift(content []byte, t reflect.Type, report func(Drift)) {
+	var tree interface{}
+	if err := json.Unmarshal(content, &tree); err != nil {
+		return
+	}
+	root := t
+	for root.Kind() == reflect.Ptr {
+		root = root.Elem()
+	}
+
+	var walk func(path string, v interface{}, t reflect.Type)
+	walk = func(path string, v interface{}, t reflect.Type) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if inner, ok := optionalTypes[t]; ok {
+			t = inner
+		} else if reflect.PtrTo(t).Implements(unmarshalerType) && !hasRawJSON(t) {
+			return // custom decoding
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if t.Kind() != reflect.Struct {
+				return // maps and interfaces accept any field
+			}
+			if expected, ok := objectNames[t]; ok {
+				if got, _ := v["object"].(string); got != "" && got != expected {
+					report(Drift{Kind: ObjectMismatch, Type: root.String(), Path: join(path, "object"), Expected: expected, Got: got})
+				}
+			}
+			fields := jsonFields(t)
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				ft, ok := fields[k]
+				if !ok {
+					report(Drift{Kind: UnknownField, Type: root.String(), Path: join(path, k)})
+					continue
+				}
+				walk(join(path, k), v[k], ft)
+			}
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if _, ok := v[name]; !ok && !optionalFields[t][name] {
+					report(Drift{Kind: MissingField, Type: root.String(), Path: join(path, name)})
+				}
+			}
+		case []interface{}:
+			if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+				return
+			}
+			for i, child := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), child, t.Elem())
+			}
+		}
+	}
+	walk("", tree, root)
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
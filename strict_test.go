@@ -0,0 +1,58 @@
+package payplug
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStrictDecoding(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/payments/pay_refund" {
+			w.Write([]byte(`{"id": "re_1", "object": "refund"}`))
+			return
+		}
+		// renamed card and hosted payment fields
+		w.Write([]byte(strings.NewReplacer(`"last4"`, `"last_four"`, `"paid_at": 1434010827`, `"paid_on": 1434010827`).Replace(paymentFixture)))
+	}))
+	defer api.Close()
+
+	var drifts []Drift
+	s := NewSession("sk_test", WithBaseUrl(api.URL), WithStrictDecoding(func(d Drift) { drifts = append(drifts, d) }))
+	if _, err := s.GetPayment("pay_1"); err != nil {
+		t.Fatal(err)
+	}
+	found := map[DriftKind]map[string]bool{UnknownField: {}, MissingField: {}, ObjectMismatch: {}}
+	for _, d := range drifts {
+		found[d.Kind][d.Path] = true
+	}
+	for _, path := range []string{"card.last_four", "hosted_payment.paid_on"} {
+		if !found[UnknownField][path] {
+			t.Fatalf("expected unknown field %s in %v", path, drifts)
+		}
+	}
+	if !found[MissingField]["card.last4"] || !found[MissingField]["hosted_payment.paid_at"] {
+		t.Fatalf("expected missing fields in %v", drifts)
+	}
+	if found[UnknownField]["metadata.customer_id"] || len(found[ObjectMismatch]) != 0 {
+		t.Fatalf("unexpected drifts %v", drifts)
+	}
+
+	drifts = nil
+	if _, err := s.GetPayment("pay_refund"); err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) == 0 || drifts[0].Kind != ObjectMismatch || drifts[0].Got != "refund" {
+		t.Fatalf("expected object mismatch, got %v", drifts)
+	}
+}
+
+func TestStrictDecodingFixture(t *testing.T) {
+	var drifts []Drift
+	checkDrift([]byte(paymentFixture), reflect.TypeOf(Payment{}), func(d Drift) { drifts = append(drifts, d) })
+	if len(drifts) != 0 {
+		t.Fatalf("unexpected drifts %v", drifts)
+	}
+}
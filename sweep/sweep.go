@@ -0,0 +1,224 @@
+// Package sweep aborts the abandoned unpaid PayPlug payments, so that
+// their hosted payment pages may not be used anymore, and reports the
+// payments whose reserved goods may be released.
+package sweep
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+// Kind is the type of an Event.
+type Kind uint8
+
+const (
+	Aborted     Kind = iota + 1 // The payment was aborted by the sweeper
+	Expired                     // The payment timed out, or was aborted by someone else
+	AbortFailed                 // The payment could not be aborted, and is still pending
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Aborted:
+		return "aborted"
+	case Expired:
+		return "expired"
+	case AbortFailed:
+		return "abort failed"
+	}
+	return fmt.Sprintf("Kind(%d)", k)
+}
+
+// Event reports an abandoned payment. Aborted and Expired events
+// are emitted once per payment and Sweeper, so that the goods reserved
+// for the payment are released once: each sweep only walks the payments
+// created since the previous one. Persisting the Checkpoint and passing it
+// to Options.Since on restart avoids reporting the same payments again.
+// A sweep failing midway is retried as a whole, which may repeat events.
+type Event struct {
+	Kind    Kind
+	Payment payplug.Payment // The latest known state of the payment
+	Err     error           // For AbortFailed
+}
+
+// Options configures a Sweeper. The zero value uses the defaults.
+type Options struct {
+	MaxAge            time.Duration     // Unpaid payments older than this are aborted, default to 1h
+	Lookback          time.Duration     // Payments older than this are ignored, default to 7 days
+	Interval          time.Duration     // Delay between two sweeps in Run, default to 5min
+	Since             payplug.Timestamp // Start of the first sweep, typically a saved Checkpoint, default to now - Lookback
+	IncludeAuthorized bool              // Also abort the authorized but not captured deferred payments
+	Logger            payplug.Logger    // Optional
+}
+
+func (o *Options) setDefaults() {
+	if o.MaxAge <= 0 {
+		o.MaxAge = time.Hour
+	}
+	if o.Lookback <= 0 {
+		o.Lookback = 7 * 24 * time.Hour
+	}
+	if o.Interval <= 0 {
+		o.Interval = 5 * time.Minute
+	}
+}
+
+// Sweeper finds and aborts abandoned payments.
+type Sweeper struct {
+	client  payplug.Client
+	onEvent func(Event)
+	opts    Options
+
+	mu     sync.Mutex
+	next   payplug.Timestamp // start of the next window
+	failed map[string]bool   // payments whose abort failed, retried by the next sweep
+}
+
+// New returns a sweeper passing its events to `onEvent`.
+func New(client payplug.Client, onEvent func(Event), opts Options) *Sweeper {
+	opts.setDefaults()
+	return &Sweeper{client: client, onEvent: onEvent, opts: opts, next: opts.Since, failed: map[string]bool{}}
+}
+
+// Checkpoint returns the creation date from which the next sweep
+// will walk the payments, zero before the first sweep.
+func (s *Sweeper) Checkpoint() payplug.Timestamp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next
+}
+
+func (s *Sweeper) logf(format string, args ...interface{}) {
+	if s.opts.Logger != nil {
+		s.opts.Logger.Printf(format, args...)
+	}
+}
+
+// abandoned returns true for the payments failed because they were not paid in time
+func abandoned(p payplug.Payment) bool {
+	return p.Failure.Valid && (p.Failure.Failure.Code == payplug.Timeout || p.Failure.Failure.Code == payplug.Aborted)
+}
+
+// forget stops retrying the abort of `id`
+func (s *Sweeper) forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failed, id)
+}
+
+func (s *Sweeper) emit(kind Kind, p payplug.Payment, err error) {
+	if kind == AbortFailed {
+		s.mu.Lock()
+		s.failed[p.Id] = true
+		s.mu.Unlock()
+	} else {
+		s.forget(p.Id)
+	}
+	if s.onEvent != nil {
+		s.onEvent(Event{Kind: kind, Payment: p, Err: err})
+	}
+}
+
+// Sweep processes the payments created since the previous sweep
+// (or Options.Since), but after now - Lookback, and before now - MaxAge.
+// The payments whose abort failed are retried.
+func (s *Sweeper) Sweep(now time.Time) error {
+	to := payplug.Timestamp(now.Add(-s.opts.MaxAge).Unix())
+	oldest := payplug.Timestamp(now.Add(-s.opts.Lookback).Unix())
+	s.mu.Lock()
+	from := s.next
+	if from < oldest {
+		from = oldest
+	}
+	failed := make([]string, 0, len(s.failed))
+	for id := range s.failed {
+		failed = append(failed, id)
+	}
+	s.mu.Unlock()
+	sort.Strings(failed)
+
+	for _, id := range failed {
+		p, err := s.client.GetPayment(id)
+		switch {
+		case err != nil:
+			s.logf("sweep: retrying %s: %s", id, err)
+		case p.CreatedAt < oldest:
+			s.logf("sweep: giving up on %s", id)
+			s.forget(id)
+		default:
+			s.process(p)
+		}
+	}
+
+	if to < from {
+		return nil
+	}
+	err := s.client.WalkPayments(from, to, func(p payplug.Payment) error {
+		s.process(p)
+		return nil
+	})
+	if err != nil {
+		return err // the window is walked again by the next sweep
+	}
+	s.mu.Lock()
+	s.next = to + 1
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Sweeper) process(p payplug.Payment) {
+	switch status := p.Status(); {
+	case abandoned(p):
+		s.emit(Expired, p, nil)
+	case p.PaymentMethod.IsPending: // completed by the payer, still analyzed by Oney
+		s.forget(p.Id)
+	case status == payplug.StatusPending, status == payplug.StatusAuthorized && s.opts.IncludeAuthorized:
+		s.abort(p)
+	default: // paid meanwhile
+		s.forget(p.Id)
+	}
+}
+
+func (s *Sweeper) abort(p payplug.Payment) {
+	aborted, err := s.client.AbortPayment(p.Id)
+	if err == nil {
+		s.emit(Aborted, aborted, nil)
+		return
+	}
+	// the payment may have changed meanwhile (paid or timed out)
+	current, errGet := s.client.GetPayment(p.Id)
+	switch {
+	case errGet != nil:
+		s.logf("sweep: aborting %s: %s", p.Id, err)
+		s.emit(AbortFailed, p, err)
+	case abandoned(current):
+		s.emit(Expired, current, nil)
+	case current.Status().IsFinal(), current.PaymentMethod.IsPending: // paid, or being analyzed by Oney
+		s.forget(p.Id)
+	default:
+		s.logf("sweep: aborting %s: %s", p.Id, err)
+		s.emit(AbortFailed, current, err)
+	}
+}
+
+// Run sweeps every Interval until `ctx` is done.
+// Sweep errors are logged, and do not stop the loop.
+func (s *Sweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sweep(time.Now()); err != nil {
+			s.logf("sweep: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package sweep
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+	"github.com/benoitkugler/payplug-go/payplugtest"
+)
+
+// createdBefore returns a creation date in the sweep window of `now`
+func createdBefore(now time.Time) payplug.Timestamp {
+	return payplug.Timestamp(now.Add(-2 * time.Hour).Unix())
+}
+
+func failed(p payplug.Payment, code payplug.PaymentFailureCode) payplug.Payment {
+	p.Failure = payplug.OptionnalFailure{Valid: true, Failure: payplug.Failure{Code: code}}
+	return p
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Now()
+	created := createdBefore(now)
+	mock := new(payplugtest.Mock)
+	mock.On("WalkPayments", []payplug.Payment{
+		{Id: "pay_1", CreatedAt: created},
+		{Id: "pay_2", CreatedAt: created, IsPaid: true},
+		failed(payplug.Payment{Id: "pay_3", CreatedAt: created}, payplug.Timeout),
+		{Id: "pay_4", CreatedAt: created},
+	}, nil)
+	mock.On("AbortPayment", failed(payplug.Payment{Id: "pay_1", CreatedAt: created}, payplug.Aborted), nil).
+		On("AbortPayment", payplug.Payment{}, payplug.NewHttpError(400, "payment already failed"))
+	mock.On("GetPayment", failed(payplug.Payment{Id: "pay_4", CreatedAt: created}, payplug.Timeout), nil)
+
+	var events []Event
+	s := New(mock, func(e Event) { events = append(events, e) }, Options{MaxAge: time.Hour})
+	if err := s.Sweep(now); err != nil {
+		t.Fatal(err)
+	}
+	call := mock.CallsTo("WalkPayments")[0]
+	if to := call.Args[1].(payplug.Timestamp); to != payplug.Timestamp(now.Add(-time.Hour).Unix()) {
+		t.Fatalf("unexpected window end %d", to)
+	}
+	exp := map[string]Kind{"pay_1": Aborted, "pay_3": Expired, "pay_4": Expired}
+	if len(events) != len(exp) {
+		t.Fatalf("unexpected events %v", events)
+	}
+	for _, e := range events {
+		if exp[e.Payment.Id] != e.Kind {
+			t.Fatalf("unexpected event %v", e)
+		}
+	}
+
+	// the next sweep starts after the previous window
+	mock.Reset()
+	mock.On("WalkPayments", nil, nil)
+	events = nil
+	if err := s.Sweep(now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	call = mock.CallsTo("WalkPayments")[0]
+	if from := call.Args[0].(payplug.Timestamp); from != payplug.Timestamp(now.Add(-time.Hour).Unix())+1 {
+		t.Fatalf("unexpected window start %d", from)
+	}
+	if len(events) != 0 || s.Checkpoint() != payplug.Timestamp(now.Add(time.Minute-time.Hour).Unix())+1 {
+		t.Fatalf("unexpected events %v", events)
+	}
+
+	// the checkpoint is used by a new sweeper
+	mock.Reset()
+	mock.On("WalkPayments", nil, errors.New("network error"))
+	restarted := New(mock, nil, Options{Since: s.Checkpoint()})
+	if err := restarted.Sweep(now.Add(2 * time.Minute)); err == nil {
+		t.Fatal("expected error")
+	}
+	if from := mock.CallsTo("WalkPayments")[0].Args[0].(payplug.Timestamp); from != s.Checkpoint() {
+		t.Fatalf("unexpected window start %d", from)
+	}
+	if restarted.Checkpoint() != s.Checkpoint() {
+		t.Fatal("a failed sweep should not move the checkpoint")
+	}
+}
+
+func TestSweepAbortFailed(t *testing.T) {
+	now := time.Now()
+	pending := payplug.Payment{Id: "pay_1", CreatedAt: createdBefore(now)}
+	mock := new(payplugtest.Mock)
+	mock.On("WalkPayments", []payplug.Payment{pending}, nil)
+	mock.On("AbortPayment", payplug.Payment{}, payplug.NewHttpError(500, "unavailable"))
+	mock.On("GetPayment", pending, nil)
+
+	var events []Event
+	s := New(mock, func(e Event) { events = append(events, e) }, Options{})
+	if err := s.Sweep(now); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != AbortFailed || events[0].Err == nil {
+		t.Fatalf("unexpected events %v", events)
+	}
+
+	// retried by the next sweep, although out of its window
+	mock.Reset()
+	mock.On("WalkPayments", nil, nil)
+	mock.On("GetPayment", pending, nil)
+	mock.On("AbortPayment", failed(pending, payplug.Aborted), nil)
+	events = nil
+	if err := s.Sweep(now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != Aborted {
+		t.Fatalf("unexpected events %v", events)
+	}
+
+	// not retried anymore
+	mock.Reset()
+	mock.On("WalkPayments", nil, nil)
+	if err := s.Sweep(now.Add(2 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(mock.CallsTo("GetPayment")) != 0 {
+		t.Fatal("unexpected retry")
+	}
+}
+
+func TestSweepIncludeAuthorized(t *testing.T) {
+	now := time.Now()
+	authorized := payplug.Payment{Id: "pay_1", CreatedAt: createdBefore(now), Authorization: payplug.OptionnalAuthorization{
+		Valid: true, Authorization: payplug.Authorization{AuthorizedAt: createdBefore(now)},
+	}}
+	for _, include := range []bool{false, true} {
+		mock := new(payplugtest.Mock)
+		mock.On("WalkPayments", []payplug.Payment{authorized}, nil)
+		mock.On("AbortPayment", failed(authorized, payplug.Aborted), nil)
+		s := New(mock, nil, Options{IncludeAuthorized: include})
+		if err := s.Sweep(now); err != nil {
+			t.Fatal(err)
+		}
+		if aborted := len(mock.CallsTo("AbortPayment")) == 1; aborted != include {
+			t.Fatalf("IncludeAuthorized %v: unexpected abort %v", include, aborted)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	mock := new(payplugtest.Mock)
+	mock.On("WalkPayments", nil, errors.New("network error")).On("WalkPayments", nil, nil)
+	s := New(mock, nil, Options{Interval: time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// errors do not stop the loop
+	if n := len(mock.CallsTo("WalkPayments")); n < 2 {
+		t.Fatalf("expected several sweeps, got %d", n)
+	}
+	if s.Checkpoint() == 0 {
+		t.Fatal("expected a completed sweep")
+	}
+}
+
+func TestSweepOneyPending(t *testing.T) {
+	now := time.Now()
+	analyzed := payplug.Payment{Id: "pay_1", CreatedAt: createdBefore(now), PaymentMethod: payplug.PaymentMethod{Type: payplug.MethodOneyX3, IsPending: true}}
+	pending := payplug.Payment{Id: "pay_2", CreatedAt: createdBefore(now)}
+	mock := new(payplugtest.Mock)
+	mock.On("WalkPayments", []payplug.Payment{analyzed, pending}, nil)
+	// pay_2 was completed meanwhile, and is now analyzed
+	mock.On("AbortPayment", payplug.Payment{}, payplug.NewHttpError(400, "payment is pending"))
+	pending.PaymentMethod = analyzed.PaymentMethod
+	mock.On("GetPayment", pending, nil)
+
+	var events []Event
+	s := New(mock, func(e Event) { events = append(events, e) }, Options{})
+	if err := s.Sweep(now); err != nil {
+		t.Fatal(err)
+	}
+	calls := mock.CallsTo("AbortPayment")
+	if len(calls) != 1 || calls[0].Args[0] != "pay_2" {
+		t.Fatalf("only pay_2 should be aborted, got %v", calls)
+	}
+	if len(events) != 0 || len(s.failed) != 0 {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
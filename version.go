@@ -0,0 +1,168 @@
+package payplug
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ApiVersion is a version of the PayPlug API, as an ISO-8601 date (YYYY-MM-DD),
+// sent in the PayPlug-Version header.
+// The empty version uses the default version of the account.
+type ApiVersion string
+
+// Known API versions
+const (
+	Version20190806 ApiVersion = "2019-08-06"
+
+	LatestApiVersion = Version20190806
+)
+
+const versionHeader = "PayPlug-Version"
+
+// ParseApiVersion validates `version`.
+func ParseApiVersion(version string) (ApiVersion, error) {
+	v := ApiVersion(version)
+	return v, v.Validate()
+}
+
+// Validate returns an error if `v` is not empty and not a valid date.
+func (v ApiVersion) Validate() error {
+	if v == "" {
+		return nil
+	}
+	if _, err := time.Parse("2006-01-02", string(v)); err != nil {
+		return ValidationError{Field: "API version", Reason: fmt.Sprintf("%q is not a YYYY-MM-DD date", string(v))}
+	}
+	return nil
+}
+
+// Before returns true if `v` is older than `other`.
+// The empty version is considered older than any other.
+func (v ApiVersion) Before(other ApiVersion) bool { return v < other }
+
+// ChangeKind is the type of a FieldChange.
+type ChangeKind uint8
+
+const (
+	FieldAdded   ChangeKind = iota + 1 // The field is absent from older versions
+	FieldRemoved                       // The field is absent from this version on
+)
+
+// FieldChange records a change in the shape of an API object.
+type FieldChange struct {
+	Version ApiVersion // First version including the change
+	Object  string     // Value of the "object" field, such as "payment"
+	Field   string     // JSON name of the field
+	Kind    ChangeKind
+	Source  string // The entry of the PayPlug API changelog announcing the change
+}
+
+// fieldChanges lists the changes of the objects modelled by this package,
+// each one citing its changelog entry.
+// No change is recorded yet: the table is only filled from the PayPlug
+// changelog. Responses are always decoded as is, whatever their version.
+var fieldChanges []FieldChange
+
+// FieldChanges returns the changes of the objects modelled by this package,
+// which is empty for now (see ChangesBetween).
+func FieldChanges() []FieldChange {
+	return append([]FieldChange(nil), fieldChanges...)
+}
+
+// ChangesBetween returns the changes of versions newer than `from`,
+// up to `to` (included): the ones to review when upgrading.
+// Since no change is recorded yet, it returns nil for now.
+func ChangesBetween(from, to ApiVersion) []FieldChange {
+	return changesBetween(fieldChanges, from, to)
+}
+
+func changesBetween(changes []FieldChange, from, to ApiVersion) []FieldChange {
+	var out []FieldChange
+	for _, c := range changes {
+		if from.Before(c.Version) && !to.Before(c.Version) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// SetApiVersion set the desired `version`, as an ISO-8601 date.
+// An invalid version makes the following requests fail with
+// a ValidationError: use ParseApiVersion to check it beforehand.
+func (s *Session) SetApiVersion(version string) {
+	s.apiVersion = ApiVersion(version)
+	s.versionErr = s.apiVersion.Validate()
+}
+
+// WarningKind is the type of a Warning.
+type WarningKind uint8
+
+const (
+	Deprecated      WarningKind = iota + 1 // The response announces a deprecation or a sunset
+	VersionMismatch                        // The response version differs from the requested one
+)
+
+// Warning is emitted when response headers call for attention,
+// without failing the request.
+type Warning struct {
+	Kind      WarningKind
+	URL       string
+	Requested ApiVersion // Version sent by the session
+	Served    ApiVersion // Version announced by the response, if any
+	Message   string     // Content of the relevant headers
+}
+
+func (w Warning) String() string {
+	switch w.Kind {
+	case Deprecated:
+		return fmt.Sprintf("deprecation for %s (version %s): %s", w.URL, w.Served, w.Message)
+	default:
+		return fmt.Sprintf("version mismatch for %s: requested %s, served %s", w.URL, w.Requested, w.Served)
+	}
+}
+
+// SetWarningHandler calls `handler` for each warning.
+// By default, warnings are sent to the logger of the session, if any.
+func (s *Session) SetWarningHandler(handler func(Warning)) {
+	s.onWarning = handler
+}
+
+// WithWarningHandler is the same as Session.SetWarningHandler.
+func WithWarningHandler(handler func(Warning)) Option {
+	return func(c *config) { c.session.SetWarningHandler(handler) }
+}
+
+func (s Session) warn(w Warning) {
+	if s.onWarning != nil {
+		s.onWarning(w)
+	} else if s.logger != nil {
+		s.logger.Printf("payplug: warning: %s", w)
+	}
+}
+
+// servedVersion returns the version of `resp`, defaulting to the requested one
+func (s Session) servedVersion(resp *http.Response) ApiVersion {
+	if v := resp.Header.Get(versionHeader); v != "" {
+		return ApiVersion(v)
+	}
+	return s.apiVersion
+}
+
+// checkHeaders emits the warnings announced by `resp`.
+func (s Session) checkHeaders(url string, resp *http.Response) {
+	served := s.servedVersion(resp)
+	if s.apiVersion != "" && served != s.apiVersion {
+		s.warn(Warning{Kind: VersionMismatch, URL: url, Requested: s.apiVersion, Served: served})
+	}
+	var messages []string
+	for _, h := range [...]string{"Deprecation", "Sunset", "Warning"} {
+		if v := resp.Header.Get(h); v != "" {
+			messages = append(messages, h+": "+v)
+		}
+	}
+	if len(messages) != 0 {
+		s.warn(Warning{Kind: Deprecated, URL: url, Requested: s.apiVersion, Served: served, Message: strings.Join(messages, "; ")})
+	}
+}
@@ -0,0 +1,53 @@
+package payplug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApiVersion(t *testing.T) {
+	if _, err := ParseApiVersion("2019-08-06"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseApiVersion("v2"); err == nil {
+		t.Fatal("expected error for invalid version")
+	}
+	if s := NewSession("sk_test", WithApiVersion("latest")); s.versionErr == nil {
+		t.Fatal("expected invalid version")
+	} else if _, err := s.GetPayment("pay_1"); err == nil {
+		t.Fatal("expected error for invalid version")
+	}
+	for _, c := range FieldChanges() {
+		if c.Source == "" {
+			t.Fatalf("missing changelog source for %+v", c)
+		}
+	}
+	changes := []FieldChange{{Version: "2030-01-01", Object: "payment", Field: "new_field", Kind: FieldAdded}}
+	if got := changesBetween(changes, LatestApiVersion, "2030-01-01"); len(got) != 1 {
+		t.Fatalf("unexpected changes %v", got)
+	}
+	if got := changesBetween(changes, "2030-01-01", "2031-01-01"); len(got) != 0 {
+		t.Fatalf("unexpected changes %v", got)
+	}
+}
+
+func TestVersionWarnings(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("PayPlug-Version", "2020-01-01")
+		w.Header().Set("Deprecation", "true")
+		json.NewEncoder(w).Encode(map[string]interface{}{"object": "card", "id": "card_1", "last4": "4242"})
+	}))
+	defer api.Close()
+
+	var warnings []Warning
+	s := NewSession("sk_test", WithBaseUrl(api.URL), WithApiVersion(LatestApiVersion),
+		WithWarningHandler(func(w Warning) { warnings = append(warnings, w) }))
+	if _, err := s.GetCard("cus_1", "card_1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 || warnings[0].Kind != VersionMismatch || warnings[1].Kind != Deprecated {
+		t.Fatalf("unexpected warnings %v", warnings)
+	}
+}
@@ -0,0 +1,213 @@
+// Package watch polls pending PayPlug payments and refunds, as a fallback
+// for lost notifications.
+//
+// Each watched object is fetched with increasing intervals until it reaches
+// a final state, and is then passed to the same NotificationCallbacks as
+// the notification handler. Using Watcher.Callbacks in the notification
+// handler stops the polling of the objects already notified.
+package watch
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+)
+
+// Options configures a Watcher. The zero value uses the defaults.
+type Options struct {
+	Initial time.Duration  // First polling interval, default to 30s
+	Max     time.Duration  // Maximum interval, default to 1h
+	MaxAge  time.Duration  // Objects are dropped after this duration, default to 48h
+	Logger  payplug.Logger // Optional
+}
+
+func (o *Options) setDefaults() {
+	if o.Initial <= 0 {
+		o.Initial = 30 * time.Second
+	}
+	if o.Max <= 0 {
+		o.Max = time.Hour
+	}
+	if o.MaxAge <= 0 {
+		o.MaxAge = 48 * time.Hour
+	}
+}
+
+// watched is a payment, or a refund if paymentId is not empty
+type watched struct {
+	id, paymentId string
+	since         time.Time
+	interval      time.Duration
+	timer         *time.Timer
+}
+
+// Watcher polls objects until they reach a final state.
+// It is safe for concurrent use.
+type Watcher struct {
+	client    payplug.Client
+	callbacks payplug.NotificationCallbacks
+	opts      Options
+
+	mu      sync.Mutex
+	objects map[string]*watched
+	closed  bool
+	polls   sync.WaitGroup
+}
+
+// New returns a watcher calling `callbacks` with the final objects.
+// Only the Payment and Refund callbacks are used.
+func New(client payplug.Client, callbacks payplug.NotificationCallbacks, opts Options) *Watcher {
+	opts.setDefaults()
+	return &Watcher{client: client, callbacks: callbacks, opts: opts, objects: map[string]*watched{}}
+}
+
+func (w *Watcher) logf(format string, args ...interface{}) {
+	if w.opts.Logger != nil {
+		w.opts.Logger.Printf(format, args...)
+	}
+}
+
+// WatchPayment polls the payment `id` until it is paid or failed.
+// Watching an already watched object has no effect.
+func (w *Watcher) WatchPayment(id string) { w.watch(&watched{id: id}) }
+
+// WatchRefund polls the payment `paymentId` until the refund `id` is listed.
+func (w *Watcher) WatchRefund(paymentId, id string) { w.watch(&watched{id: id, paymentId: paymentId}) }
+
+func (w *Watcher) watch(o *watched) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.objects[o.id] != nil {
+		return
+	}
+	o.since, o.interval = time.Now(), w.opts.Initial
+	w.objects[o.id] = o
+	o.timer = time.AfterFunc(o.interval, func() { w.poll(o) })
+}
+
+// Unwatch stops polling the object `id`, for instance
+// because its notification was received.
+func (w *Watcher) Unwatch(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if o := w.objects[id]; o != nil {
+		o.timer.Stop()
+		delete(w.objects, id)
+	}
+}
+
+// Pending returns the ids of the watched objects, sorted.
+func (w *Watcher) Pending() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]string, 0, len(w.objects))
+	for id := range w.objects {
+		out = append(out, id)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// fetch returns true if `o` is final and was passed to the callbacks
+func (w *Watcher) fetch(o *watched) (bool, error) {
+	if o.paymentId == "" {
+		p, err := w.client.GetPayment(o.id)
+		if err != nil || !p.Status().IsFinal() {
+			return false, err
+		}
+		if w.callbacks.Payment != nil {
+			err = w.callbacks.Payment(p)
+		}
+		return err == nil, err
+	}
+
+	refunds, err := w.client.ListRefunds(o.paymentId)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range refunds.Data {
+		if r.Id == o.id {
+			if w.callbacks.Refund != nil {
+				err = w.callbacks.Refund(r)
+			}
+			return err == nil, err
+		}
+	}
+	return false, nil
+}
+
+func (w *Watcher) poll(o *watched) {
+	w.mu.Lock()
+	if w.closed || w.objects[o.id] != o { // unwatched meanwhile
+		w.mu.Unlock()
+		return
+	}
+	w.polls.Add(1)
+	w.mu.Unlock()
+	defer w.polls.Done()
+
+	done, err := w.fetch(o)
+	if err != nil {
+		w.logf("watch: polling %s: %s", o.id, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.objects[o.id] != o {
+		return
+	}
+	if done {
+		delete(w.objects, o.id)
+		return
+	}
+	if time.Since(o.since) >= w.opts.MaxAge {
+		w.logf("watch: giving up on %s after %s", o.id, w.opts.MaxAge)
+		delete(w.objects, o.id)
+		return
+	}
+	if w.closed {
+		return
+	}
+	o.interval *= 2
+	if o.interval > w.opts.Max {
+		o.interval = w.opts.Max
+	}
+	o.timer = time.AfterFunc(o.interval, func() { w.poll(o) })
+}
+
+// Callbacks returns the callbacks of the watcher, unwatching the objects
+// they receive. They are meant to be used by the notification handler
+// (see the queue package), so that notified objects are not polled anymore.
+func (w *Watcher) Callbacks() payplug.NotificationCallbacks {
+	out := w.callbacks
+	out.Payment = func(p payplug.Payment) error {
+		if p.Status().IsFinal() {
+			w.Unwatch(p.Id)
+		}
+		if w.callbacks.Payment == nil {
+			return nil
+		}
+		return w.callbacks.Payment(p)
+	}
+	out.Refund = func(r payplug.Refund) error {
+		w.Unwatch(r.Id)
+		if w.callbacks.Refund == nil {
+			return nil
+		}
+		return w.callbacks.Refund(r)
+	}
+	return out
+}
+
+// Close stops the polling and waits for the running polls.
+func (w *Watcher) Close() {
+	w.mu.Lock()
+	w.closed = true
+	for _, o := range w.objects {
+		o.timer.Stop()
+	}
+	w.mu.Unlock()
+	w.polls.Wait()
+}
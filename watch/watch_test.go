@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	payplug "github.com/benoitkugler/payplug-go"
+	"github.com/benoitkugler/payplug-go/payplugtest"
+)
+
+func TestWatcher(t *testing.T) {
+	mock := new(payplugtest.Mock)
+	mock.On("GetPayment", payplug.Payment{Id: "pay_1"}, nil).
+		On("GetPayment", payplug.Payment{Id: "pay_1"}, nil).
+		On("GetPayment", payplug.Payment{Id: "pay_1", IsPaid: true}, nil)
+	mock.On("ListRefunds", payplug.RefundList{}, nil).
+		On("ListRefunds", payplug.RefundList{Data: []payplug.Refund{{Id: "re_1", PaymentId: "pay_2"}}}, nil)
+
+	var (
+		mu    sync.Mutex
+		final []string
+	)
+	record := func(id string) {
+		mu.Lock()
+		defer mu.Unlock()
+		final = append(final, id)
+	}
+	w := New(mock, payplug.NotificationCallbacks{
+		Payment: func(p payplug.Payment) error { record(p.Id); return nil },
+		Refund:  func(r payplug.Refund) error { record(r.Id); return nil },
+	}, Options{Initial: time.Millisecond, Max: 4 * time.Millisecond})
+	defer w.Close()
+
+	w.WatchPayment("pay_1")
+	w.WatchRefund("pay_2", "re_1")
+
+	for i := 0; i < 100 && len(w.Pending()) != 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if p := w.Pending(); len(p) != 0 {
+		t.Fatalf("unexpected pending objects %v", p)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(final) != 2 {
+		t.Fatalf("unexpected final objects %v", final)
+	}
+	polls := 0
+	for _, c := range mock.CallsTo("GetPayment") {
+		if c.Args[0] == "pay_1" {
+			polls++
+		}
+	}
+	if polls != 3 {
+		t.Fatalf("expected 3 polls, got %d", polls)
+	}
+}
+
+func TestWatcherCallbacks(t *testing.T) {
+	w := New(new(payplugtest.Mock), payplug.NotificationCallbacks{}, Options{Initial: time.Hour})
+	defer w.Close()
+	w.WatchPayment("pay_1")
+	w.WatchPayment("pay_2")
+	w.Callbacks().Payment(payplug.Payment{Id: "pay_1", IsPaid: true}) // notified
+	w.Callbacks().Payment(payplug.Payment{Id: "pay_2"})               // still pending
+	if p := w.Pending(); len(p) != 1 || p[0] != "pay_2" {
+		t.Fatalf("unexpected pending objects %v", p)
+	}
+}